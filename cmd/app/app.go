@@ -1,19 +1,25 @@
 package app
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/sphierex/blockchain-go/internal/blockchain"
-	"github.com/sphierex/blockchain-go/pkg/base58"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 )
 
 type App struct {
 	rootCmd *cobra.Command
 
-	node string
+	node    string
+	network string
+	// checkpoints and assumeValid are height:hash pairs added to the
+	// parameters of the network.
+	checkpoints []string
+	assumeValid string
 }
 
 func New() *App {
@@ -29,20 +35,69 @@ func (a *App) init() {
 
 	rootCmd := &cobra.Command{
 		Use: "go-blockchain",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := blockchain.SelectParams(a.network); err != nil {
+				return err
+			}
+
+			for _, c := range a.checkpoints {
+				cp, err := blockchain.ParseCheckpoint(c)
+				if err != nil {
+					return err
+				}
+				blockchain.AddCheckpoint(cp)
+			}
+			if a.assumeValid != "" {
+				cp, err := blockchain.ParseCheckpoint(a.assumeValid)
+				if err != nil {
+					return err
+				}
+				blockchain.SetAssumeValid(cp)
+			}
+
+			return nil
+		},
+	}
+
+	network := os.Getenv("NETWORK")
+	if network == "" {
+		network = blockchain.MainNetParams.Name
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&a.node, "node", "n", os.Getenv("NODE"), "")
+	rootCmd.PersistentFlags().StringVarP(&a.network, "network", "", network, "The network to use: main, test or regtest")
+	rootCmd.PersistentFlags().StringSliceVarP(&a.checkpoints, "checkpoint", "", nil, "A block of the best chain as height:hash, forks below it are rejected")
+	rootCmd.PersistentFlags().StringVarP(&a.assumeValid, "assume-valid", "", "", "A block of the best chain as height:hash, signatures of its ancestors are not checked")
 	_ = rootCmd.MarkFlagRequired("node")
 
 	rootCmd.AddCommand(
 		a.createChainCmd(),
 		a.createWalletCmd(),
+		a.createMultiSigCmd(),
+		a.importAddressCmd(),
+		a.importPubKeyCmd(),
+		a.exportPubKeyCmd(),
+		a.dumpPrivKeyCmd(),
+		a.importPrivKeyCmd(),
+		a.signMessageCmd(),
+		a.verifyMessageCmd(),
 		a.printChainCmd(),
 		a.printAddressCmd(),
+		a.labelCmd(),
+		a.backupWalletCmd(),
+		a.restoreWalletCmd(),
 		a.getBalanceCmd(),
+		a.historyCmd(),
+		a.getTxProofCmd(),
+		a.verifyTxProofCmd(),
 		a.rebuildChainStateCmd(),
 		a.transformCmd(),
+		a.bumpFeeCmd(),
+		a.signTxCmd(),
 		a.startServerCmd(),
+		a.startLightClientCmd(),
+		a.trackTxCmd(),
+		a.lightStatusCmd(),
 	)
 	a.rootCmd = rootCmd
 }
@@ -54,8 +109,8 @@ func (a *App) createChainCmd() *cobra.Command {
 		Use:   "create-chain",
 		Short: "Create a blockchain and send genesis block reward to address",
 		Run: func(cmd *cobra.Command, args []string) {
-			if !blockchain.ValidateAddress(address) {
-				log.Println("address is not valid")
+			if _, err := blockchain.ValidateAddress(address); err != nil {
+				log.Println(err)
 				os.Exit(1)
 			}
 
@@ -99,6 +154,302 @@ func (a *App) createWalletCmd() *cobra.Command {
 	}
 }
 
+func (a *App) createMultiSigCmd() *cobra.Command {
+	var required int
+	var keys []string
+
+	createMultiSigCmd := &cobra.Command{
+		Use:   "create-multisig",
+		Short: "Create an m-of-n multisig P2SH address and add it to the wallet",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, _ := blockchain.NewWallet(a.node)
+
+			var pubKeys [][]byte
+			for _, key := range keys {
+				if account, ok := wallet.Accounts[key]; ok {
+					pubKeys = append(pubKeys, account.PublicKey)
+					continue
+				}
+
+				pubKey, err := hex.DecodeString(key)
+				if err != nil {
+					cmd.Printf("key %s is neither a wallet address nor a hex public key\n", key)
+					os.Exit(1)
+				}
+				pubKeys = append(pubKeys, pubKey)
+			}
+
+			redeemScript, err := blockchain.NewMultiSigScript(required, pubKeys)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			address := wallet.AddScript(redeemScript)
+			if err := wallet.Save(a.node); err != nil {
+				cmd.Printf("save wallet: %s", err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("New address: %s\n", address)
+			cmd.Printf("Redeem script: %x\n", redeemScript)
+		},
+	}
+
+	createMultiSigCmd.Flags().IntVarP(&required, "required", "", 0, "The number of signatures needed to spend")
+	createMultiSigCmd.Flags().StringArrayVarP(&keys, "key", "", nil, "A wallet address or hex public key, repeat for each key")
+	_ = createMultiSigCmd.MarkFlagRequired("required")
+	_ = createMultiSigCmd.MarkFlagRequired("key")
+
+	return createMultiSigCmd
+}
+
+func (a *App) importAddressCmd() *cobra.Command {
+	var address string
+
+	importAddressCmd := &cobra.Command{
+		Use:   "import-address",
+		Short: "Watch an address without its private key",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, _ := blockchain.NewWallet(a.node)
+			if err := wallet.ImportAddress(address); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := wallet.Save(a.node); err != nil {
+				cmd.Printf("save wallet: %s", err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("Watching address: %s\n", address)
+		},
+	}
+
+	importAddressCmd.Flags().StringVarP(&address, "address", "", "", "The address to watch")
+	_ = importAddressCmd.MarkFlagRequired("address")
+
+	return importAddressCmd
+}
+
+func (a *App) importPubKeyCmd() *cobra.Command {
+	var pubKey string
+
+	importPubKeyCmd := &cobra.Command{
+		Use:   "import-pubkey",
+		Short: "Watch the address of a public key without its private key",
+		Run: func(cmd *cobra.Command, args []string) {
+			key, err := hex.DecodeString(pubKey)
+			if err != nil {
+				cmd.Println("public key is not valid hex")
+				os.Exit(1)
+			}
+
+			wallet, _ := blockchain.NewWallet(a.node)
+			address, err := wallet.ImportPubKey(key)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := wallet.Save(a.node); err != nil {
+				cmd.Printf("save wallet: %s", err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("Watching address: %s\n", address)
+		},
+	}
+
+	importPubKeyCmd.Flags().StringVarP(&pubKey, "pubkey", "", "", "The hex public key to watch")
+	_ = importPubKeyCmd.MarkFlagRequired("pubkey")
+
+	return importPubKeyCmd
+}
+
+func (a *App) exportPubKeyCmd() *cobra.Command {
+	var address string
+
+	exportPubKeyCmd := &cobra.Command{
+		Use:   "export-pubkey",
+		Short: "Print the public key of a wallet address",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, err := blockchain.NewWallet(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			pubKey, ok := wallet.GetPubKey(address)
+			if !ok {
+				cmd.Printf("no public key for %s in the wallet\n", address)
+				os.Exit(1)
+			}
+
+			cmd.Printf("%x\n", pubKey)
+		},
+	}
+
+	exportPubKeyCmd.Flags().StringVarP(&address, "address", "", "", "The wallet address")
+	_ = exportPubKeyCmd.MarkFlagRequired("address")
+
+	return exportPubKeyCmd
+}
+
+func (a *App) dumpPrivKeyCmd() *cobra.Command {
+	var address string
+
+	dumpPrivKeyCmd := &cobra.Command{
+		Use:   "dump-privkey",
+		Short: "Print the private key of a wallet address in Wallet Import Format",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, err := blockchain.NewWallet(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			account, ok := wallet.Accounts[address]
+			if !ok {
+				cmd.Printf("no private key for %s in the wallet\n", address)
+				os.Exit(1)
+			}
+
+			cmd.Println(account.WIF())
+		},
+	}
+
+	dumpPrivKeyCmd.Flags().StringVarP(&address, "address", "", "", "The wallet address")
+	_ = dumpPrivKeyCmd.MarkFlagRequired("address")
+
+	return dumpPrivKeyCmd
+}
+
+func (a *App) importPrivKeyCmd() *cobra.Command {
+	var wif string
+	var rescan bool
+
+	importPrivKeyCmd := &cobra.Command{
+		Use:   "import-privkey",
+		Short: "Add a private key in Wallet Import Format to the wallet",
+		Run: func(cmd *cobra.Command, args []string) {
+			account, err := blockchain.DecodeWIF(wif)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			wallet, _ := blockchain.NewWallet(a.node)
+			address := wallet.ImportAccount(account)
+			if err := wallet.Save(a.node); err != nil {
+				cmd.Printf("save wallet: %s", err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("Imported address: %s\n", address)
+
+			if !rescan {
+				return
+			}
+
+			bc, err := blockchain.NewBlockchain(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			UTXOSet := blockchain.NewUTXOSet(bc)
+			if err := UTXOSet.Rebuild(); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			addr, _ := blockchain.ValidateAddress(address)
+			history, err := bc.History([]*blockchain.Address{addr})
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			balance := 0
+			for _, out := range UTXOSet.GetUTXO(addr) {
+				balance += out.Value
+			}
+
+			cmd.Printf("Found %d transactions, balance: %d\n", len(history), balance)
+		},
+	}
+
+	importPrivKeyCmd.Flags().StringVarP(&wif, "wif", "", "", "The private key in Wallet Import Format")
+	importPrivKeyCmd.Flags().BoolVarP(&rescan, "rescan", "", false, "Rebuild the chain state and report the transactions of the key")
+	_ = importPrivKeyCmd.MarkFlagRequired("wif")
+
+	return importPrivKeyCmd
+}
+
+func (a *App) signMessageCmd() *cobra.Command {
+	var address, message string
+
+	signMessageCmd := &cobra.Command{
+		Use:   "sign-message",
+		Short: "Sign a message with the key of a wallet address to prove owning it",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, err := blockchain.NewWallet(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			account, ok := wallet.Accounts[address]
+			if !ok {
+				cmd.Printf("no private key for %s in the wallet\n", address)
+				os.Exit(1)
+			}
+
+			signature, err := account.SignMessage(message)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			cmd.Println(signature)
+		},
+	}
+
+	signMessageCmd.Flags().StringVarP(&address, "address", "", "", "The wallet address signing the message")
+	signMessageCmd.Flags().StringVarP(&message, "message", "", "", "The message to sign")
+	_ = signMessageCmd.MarkFlagRequired("address")
+	_ = signMessageCmd.MarkFlagRequired("message")
+
+	return signMessageCmd
+}
+
+func (a *App) verifyMessageCmd() *cobra.Command {
+	var address, signature, message string
+
+	verifyMessageCmd := &cobra.Command{
+		Use:   "verify-message",
+		Short: "Check a message signature made by sign-message",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := blockchain.VerifyMessage(address, signature, message); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			cmd.Println("signature is valid")
+		},
+	}
+
+	verifyMessageCmd.Flags().StringVarP(&address, "address", "", "", "The address that signed the message")
+	verifyMessageCmd.Flags().StringVarP(&signature, "signature", "", "", "The signature printed by sign-message")
+	verifyMessageCmd.Flags().StringVarP(&message, "message", "", "", "The signed message")
+	_ = verifyMessageCmd.MarkFlagRequired("address")
+	_ = verifyMessageCmd.MarkFlagRequired("signature")
+	_ = verifyMessageCmd.MarkFlagRequired("message")
+
+	return verifyMessageCmd
+}
+
 func (a *App) printChainCmd() *cobra.Command {
 	return &cobra.Command{
 		Use: "print-chain",
@@ -113,6 +464,7 @@ func (a *App) printChainCmd() *cobra.Command {
 				fmt.Printf("============ Block %x ============\n", block.Hash)
 				fmt.Printf("Height: %d\n", block.Height)
 				fmt.Printf("Prev. block: %x\n", block.PrevBlockHash)
+				fmt.Printf("Merkle root: %x\n", block.MerkleRoot)
 				pow := blockchain.NewProofOfWork(block)
 				fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
 				for _, tx := range block.Transactions {
@@ -137,13 +489,104 @@ func (a *App) printAddressCmd() *cobra.Command {
 			}
 			addresses := wallet.GetAddresses()
 			for i, address := range addresses {
-				fmt.Printf("%d: %s\r\n", i+1, address)
+				info := wallet.GetInfo(address)
+				line := fmt.Sprintf("%d: %s", i+1, address)
+				if info.Purpose != "" {
+					line += fmt.Sprintf(" [%s]", info.Purpose)
+				}
+				if wallet.IsWatchOnly(address) {
+					line += " (watch-only)"
+				}
+				if info.Label != "" {
+					line += fmt.Sprintf(" %q", info.Label)
+				}
+				fmt.Printf("%s\r\n", line)
 			}
 			fmt.Printf("total address: %d\r\n", len(addresses))
 		},
 	}
 }
 
+func (a *App) labelCmd() *cobra.Command {
+	var address, label, notes string
+
+	labelCmd := &cobra.Command{
+		Use:   "label",
+		Short: "Set the label and notes of a wallet address",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, err := blockchain.NewWallet(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := wallet.SetLabel(address, label, notes); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := wallet.Save(a.node); err != nil {
+				cmd.Printf("save wallet: %s", err)
+				os.Exit(1)
+			}
+
+			cmd.Println("success")
+		},
+	}
+
+	labelCmd.Flags().StringVarP(&address, "address", "", "", "The wallet address")
+	labelCmd.Flags().StringVarP(&label, "label", "", "", "A short name for the address")
+	labelCmd.Flags().StringVarP(&notes, "notes", "", "", "Free-form notes about the address")
+	_ = labelCmd.MarkFlagRequired("address")
+
+	return labelCmd
+}
+
+func (a *App) backupWalletCmd() *cobra.Command {
+	var dest string
+
+	backupWalletCmd := &cobra.Command{
+		Use:   "backup-wallet",
+		Short: "Copy the wallet file, to a timestamped backup by default",
+		Run: func(cmd *cobra.Command, args []string) {
+			backup, err := blockchain.BackupWallet(a.node, dest)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("Wallet backed up to %s\n", backup)
+		},
+	}
+
+	backupWalletCmd.Flags().StringVarP(&dest, "dest", "", "", "The file to write the backup to")
+
+	return backupWalletCmd
+}
+
+func (a *App) restoreWalletCmd() *cobra.Command {
+	var src string
+
+	restoreWalletCmd := &cobra.Command{
+		Use:   "restore-wallet",
+		Short: "Replace the wallet with a backup, the current wallet is backed up first",
+		Run: func(cmd *cobra.Command, args []string) {
+			wallet, err := blockchain.RestoreWallet(a.node, src)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			cmd.Printf("Restored %d addresses\n", len(wallet.GetAddresses()))
+		},
+	}
+
+	restoreWalletCmd.Flags().StringVarP(&src, "src", "", "", "The backup file to restore")
+	_ = restoreWalletCmd.MarkFlagRequired("src")
+
+	return restoreWalletCmd
+}
+
 func (a *App) getBalanceCmd() *cobra.Command {
 	var address string
 
@@ -151,8 +594,9 @@ func (a *App) getBalanceCmd() *cobra.Command {
 		Use:   "get-balance",
 		Short: "Create a blockchain and send genesis block reward to address",
 		Run: func(cmd *cobra.Command, args []string) {
-			if !blockchain.ValidateAddress(address) {
-				cmd.Println("address is not valid")
+			addr, err := blockchain.ValidateAddress(address)
+			if err != nil {
+				cmd.Println(err)
 				os.Exit(1)
 			}
 
@@ -163,17 +607,12 @@ func (a *App) getBalanceCmd() *cobra.Command {
 			}
 
 			UTXOSet := blockchain.NewUTXOSet(bc)
-			balance := 0
-
-			pubKeyHash := base58.Decode([]byte(address))
-			pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-
-			UTXOs := UTXOSet.GetUTXO(pubKeyHash)
-			for _, out := range UTXOs {
-				balance += out.Value
-			}
+			balance, immature := UTXOSet.GetBalance(addr)
 
 			fmt.Printf("Balance of '%s': %d\n", address, balance)
+			if immature > 0 {
+				fmt.Printf("Immature coinbase of '%s': %d\n", address, immature)
+			}
 		},
 	}
 
@@ -183,6 +622,134 @@ func (a *App) getBalanceCmd() *cobra.Command {
 	return getBalanceCmd
 }
 
+func (a *App) historyCmd() *cobra.Command {
+	var addresses []string
+	var format string
+
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the confirmed transactions of addresses, all wallet addresses by default",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(addresses) == 0 {
+				wallet, err := blockchain.NewWallet(a.node)
+				if err != nil {
+					cmd.Println(err)
+					os.Exit(1)
+				}
+				addresses = wallet.GetAddresses()
+			}
+
+			var addrs []*blockchain.Address
+			for _, address := range addresses {
+				addr, err := blockchain.ValidateAddress(address)
+				if err != nil {
+					cmd.Printf("address %s is not valid\n", address)
+					os.Exit(1)
+				}
+				addrs = append(addrs, addr)
+			}
+
+			bc, err := blockchain.NewBlockchain(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			history, err := bc.History(addrs)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := writeHistory(cmd.OutOrStdout(), format, history); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	historyCmd.Flags().StringArrayVarP(&addresses, "address", "", nil, "An address to list, repeat for several")
+	historyCmd.Flags().StringVarP(&format, "format", "", "text", "The output format: text, json or csv")
+
+	return historyCmd
+}
+
+func (a *App) getTxProofCmd() *cobra.Command {
+	var txID string
+
+	getTxProofCmd := &cobra.Command{
+		Use:   "get-tx-proof",
+		Short: "Print the proof that a confirmed transaction is in its block",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := hex.DecodeString(txID)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			bc, err := blockchain.NewBlockchain(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			proof, err := bc.GetTxProof(id)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := writeTxProof(cmd.OutOrStdout(), proof); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	getTxProofCmd.Flags().StringVarP(&txID, "txid", "", "", "The transaction id")
+	_ = getTxProofCmd.MarkFlagRequired("txid")
+
+	return getTxProofCmd
+}
+
+func (a *App) verifyTxProofCmd() *cobra.Command {
+	var path, merkleRoot string
+
+	verifyTxProofCmd := &cobra.Command{
+		Use:   "verify-tx-proof",
+		Short: "Check a transaction proof against the merkle root of a block header",
+		Run: func(cmd *cobra.Command, args []string) {
+			proof, err := readTxProof(path)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			root, err := hex.DecodeString(merkleRoot)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if !proof.Verify(root) {
+				cmd.Printf("transaction %x is not in the block\n", proof.Tx.ID)
+				os.Exit(1)
+			}
+
+			// the block hash and height of the file aren't covered by the
+			// proof, only the merkle root the caller trusts is.
+			fmt.Printf("Transaction %x is in the block with merkle root %x\n", proof.Tx.ID, root)
+		},
+	}
+
+	verifyTxProofCmd.Flags().StringVarP(&path, "proof", "", "", "The proof file written by get-tx-proof")
+	verifyTxProofCmd.Flags().StringVarP(&merkleRoot, "merkle-root", "", "", "The trusted merkle root of the block")
+	_ = verifyTxProofCmd.MarkFlagRequired("proof")
+	_ = verifyTxProofCmd.MarkFlagRequired("merkle-root")
+
+	return verifyTxProofCmd
+}
+
 func (a *App) rebuildChainStateCmd() *cobra.Command {
 	return &cobra.Command{
 		Use: "rebuild-chain-state",
@@ -206,23 +773,57 @@ func (a *App) rebuildChainStateCmd() *cobra.Command {
 }
 
 func (a *App) transformCmd() *cobra.Command {
-	var from, to string
-	var amount int
-	var mine bool
+	var coinSelection, payoutFile string
+	var from, to []string
+	var amount, fee int
+	var lockTime int64
+	var mine, replaceable, fromWallet, unsigned bool
 
 	transformCmd := &cobra.Command{
 		Use: "transfer",
 		Run: func(cmd *cobra.Command, args []string) {
 
-			if !blockchain.ValidateAddress(from) {
-				cmd.Println("sender address is not valid")
+			if len(from) == 0 && !fromWallet {
+				cmd.Println("no sender, use --from or --from-wallet")
 				os.Exit(1)
 			}
+			for _, f := range from {
+				fromAddr, err := blockchain.ValidateAddress(f)
+				// the wallet signs script hash inputs with sign-tx.
+				if err != nil || (fromAddr.Kind != blockchain.PubKeyHashAddress && !unsigned) {
+					cmd.Printf("sender address %s is not valid\n", f)
+					os.Exit(1)
+				}
+			}
+
+			var payments []blockchain.Payment
+			for _, t := range to {
+				payment, err := parsePayment(t, amount)
+				if err != nil {
+					cmd.Println(err)
+					os.Exit(1)
+				}
+				payments = append(payments, payment)
+			}
+			if payoutFile != "" {
+				filePayments, err := readPayoutFile(payoutFile)
+				if err != nil {
+					cmd.Println(err)
+					os.Exit(1)
+				}
+				payments = append(payments, filePayments...)
+			}
 
-			if !blockchain.ValidateAddress(to) {
-				cmd.Println("recipient address is not valid")
+			if len(payments) == 0 {
+				cmd.Println("no recipient, use --to or --payout-file")
 				os.Exit(1)
 			}
+			for _, p := range payments {
+				if _, err := blockchain.ValidateAddress(p.To); err != nil {
+					cmd.Printf("recipient address %s is not valid\n", p.To)
+					os.Exit(1)
+				}
+			}
 
 			bc, err := blockchain.NewBlockchain(a.node)
 			if err != nil {
@@ -238,56 +839,261 @@ func (a *App) transformCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			account := wallet.GetAccount(from)
+			// unsigned transactions can spend from watch-only and multisig
+			// addresses too, their change goes to the first sender.
+			var senders []string
+			used := make(map[string]bool)
+			for _, f := range from {
+				_, ok := wallet.Accounts[f]
+				_, script := wallet.GetScript(f)
+				if !ok && !(unsigned && (wallet.IsWatchOnly(f) || script)) {
+					cmd.Printf("sender address %s is not in the wallet\n", f)
+					os.Exit(1)
+				}
+				if !used[f] {
+					used[f] = true
+					senders = append(senders, f)
+				}
+			}
+			if fromWallet {
+				var addresses []string
+				for address := range wallet.Accounts {
+					addresses = append(addresses, address)
+				}
+				if unsigned {
+					for address := range wallet.WatchOnly {
+						addresses = append(addresses, address)
+					}
+					for address := range wallet.Scripts {
+						addresses = append(addresses, address)
+					}
+				}
+				sort.Strings(addresses)
+
+				for _, address := range addresses {
+					if !used[address] {
+						senders = append(senders, address)
+					}
+				}
+			}
 
-			tx, err := blockchain.NewUTXOTransaction(&account, to, amount, UTXOSet)
+			selector, err := blockchain.CoinSelectorByName(coinSelection)
 			if err != nil {
 				cmd.Println(err)
 				os.Exit(1)
 			}
 
-			if mine {
-				cTx := blockchain.NewCoinbaseTx(from, "")
-				txs := []*blockchain.Transaction{cTx, tx}
+			opts := []blockchain.TxOption{
+				blockchain.WithLockTime(lockTime),
+				blockchain.WithFee(fee),
+				blockchain.WithCoinSelection(selector),
+			}
+			if replaceable {
+				opts = append(opts, blockchain.WithReplaceable())
+			}
 
-				nBlock, err := bc.Mine(txs)
+			if unsigned {
+				tx, err := blockchain.NewUnsignedTransaction(senders, payments, UTXOSet, opts...)
 				if err != nil {
 					cmd.Println(err)
 					os.Exit(1)
 				}
 
-				err = UTXOSet.Update(nBlock)
-				if err != nil {
+				cmd.Printf("%x\n", tx.Serialize())
+				return
+			}
+
+			var accounts []*blockchain.Account
+			for _, sender := range senders {
+				accounts = append(accounts, wallet.Accounts[sender])
+			}
+
+			// every transaction gets a fresh change address.
+			change := wallet.NewChangeAccount()
+			opts = append(opts, blockchain.WithChangeAddress(change))
+
+			tx, err := blockchain.NewBatchTransaction(accounts, payments, UTXOSet, opts...)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			for _, out := range tx.Vout {
+				if out.Address() == change {
+					if err := wallet.Save(a.node); err != nil {
+						cmd.Printf("save wallet: %s", err)
+						os.Exit(1)
+					}
+					break
+				}
+			}
+
+			if mine {
+				cTx := blockchain.NewCoinbaseTx(accounts[0].String(), "", bc.GetBestHeight()+1)
+				txs := []*blockchain.Transaction{cTx, tx}
+
+				if _, err := bc.Mine(txs); err != nil {
 					cmd.Println(err)
 					os.Exit(1)
 				}
 			} else {
 				s := blockchain.NewServerWithBlockchain(bc, a.node, "")
 				s.SendTx(tx)
+
+				if err := bc.SaveUnconfirmed(tx); err != nil {
+					cmd.Println(err)
+				}
 			}
 
+			cmd.Printf("txid: %x\n", tx.ID)
 			cmd.Println("success")
 		},
 	}
-	transformCmd.Flags().StringVarP(&from, "from", "", "", "")
-	transformCmd.Flags().StringVarP(&to, "to", "", "", "")
-	transformCmd.Flags().IntVarP(&amount, "amount", "", 0, "")
+	transformCmd.Flags().StringArrayVarP(&from, "from", "", nil, "A wallet address to spend from, repeat to combine accounts")
+	transformCmd.Flags().BoolVarP(&fromWallet, "from-wallet", "", false, "Spend from every account in the wallet")
+	transformCmd.Flags().StringArrayVarP(&to, "to", "", nil, "A recipient address or address:amount, repeat for each payment")
+	transformCmd.Flags().IntVarP(&amount, "amount", "", 0, "The amount paid to recipients given without one")
+	transformCmd.Flags().StringVarP(&payoutFile, "payout-file", "", "", "A CSV or JSON file of recipients and amounts")
+	transformCmd.Flags().Int64VarP(&lockTime, "locktime", "", 0, "Block height or unix timestamp before which the transaction is invalid")
+	transformCmd.Flags().IntVarP(&fee, "fee", "", 0, "The fee paid to the miner")
+	transformCmd.Flags().BoolVarP(&replaceable, "replaceable", "", false, "Allow replacing the transaction with bump-fee until it is mined")
+	transformCmd.Flags().StringVarP(&coinSelection, "coin-selection", "", "bnb", "The coin selection strategy: bnb, largest-first or random-improve")
 	transformCmd.Flags().BoolVarP(&mine, "mine", "", false, "")
-	_ = transformCmd.MarkFlagRequired("from")
-	_ = transformCmd.MarkFlagRequired("to")
-	_ = transformCmd.MarkFlagRequired("amount")
+	transformCmd.Flags().BoolVarP(&unsigned, "unsigned", "", false, "Print the unsigned transaction instead of sending it, senders may be watch-only")
 
 	return transformCmd
 }
 
+func (a *App) bumpFeeCmd() *cobra.Command {
+	var txID string
+	var fee int
+
+	bumpFeeCmd := &cobra.Command{
+		Use:   "bump-fee",
+		Short: "Replace an unconfirmed replaceable transaction with one paying a higher fee",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := hex.DecodeString(txID)
+			if err != nil {
+				cmd.Println("txid is not valid")
+				os.Exit(1)
+			}
+
+			bc, err := blockchain.NewBlockchain(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if mined, _ := bc.GetTransactionById(id); mined.ID != nil {
+				cmd.Println("transaction is already mined")
+				os.Exit(1)
+			}
+
+			orig, err := bc.GetUnconfirmed(id)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			wallet, err := blockchain.NewWallet(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			tx, err := blockchain.BumpFee(orig, wallet, fee, wallet.ChangeOutput(orig), blockchain.NewUTXOSet(bc))
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			s := blockchain.NewServerWithBlockchain(bc, a.node, "")
+			s.SendTx(tx)
+
+			_ = bc.DeleteUnconfirmed(orig.ID)
+			if err := bc.SaveUnconfirmed(tx); err != nil {
+				cmd.Println(err)
+			}
+
+			cmd.Printf("txid: %x\n", tx.ID)
+			cmd.Println("success")
+		},
+	}
+
+	bumpFeeCmd.Flags().StringVarP(&txID, "txid", "", "", "The id of the transaction to replace")
+	bumpFeeCmd.Flags().IntVarP(&fee, "fee", "", 0, "The new fee, higher than the current one")
+	_ = bumpFeeCmd.MarkFlagRequired("txid")
+	_ = bumpFeeCmd.MarkFlagRequired("fee")
+
+	return bumpFeeCmd
+}
+
+func (a *App) signTxCmd() *cobra.Command {
+	var rawTx string
+	var send bool
+
+	signTxCmd := &cobra.Command{
+		Use:   "sign-tx",
+		Short: "Sign the inputs of a hex transaction with the wallet keys",
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := hex.DecodeString(rawTx)
+			if err != nil {
+				cmd.Println("transaction is not valid hex")
+				os.Exit(1)
+			}
+			tx := blockchain.DeserializeTx(data)
+
+			bc, err := blockchain.NewBlockchain(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			wallet, err := blockchain.NewWallet(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := bc.SignTx(&tx, wallet); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			complete := bc.VerifyTx(&tx)
+			if !send || !complete {
+				cmd.Printf("%x\n", tx.Serialize())
+				cmd.Printf("complete: %t\n", complete)
+				return
+			}
+
+			s := blockchain.NewServerWithBlockchain(bc, a.node, "")
+			s.SendTx(&tx)
+
+			if err := bc.SaveUnconfirmed(&tx); err != nil {
+				cmd.Println(err)
+			}
+
+			cmd.Printf("txid: %x\n", tx.ID)
+			cmd.Println("success")
+		},
+	}
+
+	signTxCmd.Flags().StringVarP(&rawTx, "tx", "", "", "The hex transaction, as printed by transfer --unsigned")
+	signTxCmd.Flags().BoolVarP(&send, "send", "", false, "Send the transaction once every input is signed")
+	_ = signTxCmd.MarkFlagRequired("tx")
+
+	return signTxCmd
+}
+
 func (a *App) startServerCmd() *cobra.Command {
 	var address string
 
 	getBalanceCmd := &cobra.Command{
 		Use: "start-server",
 		Run: func(cmd *cobra.Command, args []string) {
-			if !blockchain.ValidateAddress(address) {
-				cmd.Println("address is not valid")
+			if _, err := blockchain.ValidateAddress(address); err != nil {
+				cmd.Println(err)
 				os.Exit(1)
 			}
 
@@ -308,3 +1114,85 @@ func (a *App) startServerCmd() *cobra.Command {
 func (a *App) Execute() error {
 	return a.rootCmd.Execute()
 }
+
+func (a *App) startLightClientCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "start-light-client",
+		Short: "Start a node that only syncs block headers and checks tracked transactions with merkle proofs",
+		Run: func(cmd *cobra.Command, args []string) {
+			c, err := blockchain.NewLightClient(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := c.Start(); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func (a *App) trackTxCmd() *cobra.Command {
+	var txID string
+
+	trackTxCmd := &cobra.Command{
+		Use:   "track-tx",
+		Short: "Make the light client check that a transaction is confirmed",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := hex.DecodeString(txID)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			if err := blockchain.TrackTx(a.node, id); err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	trackTxCmd.Flags().StringVarP(&txID, "txid", "", "", "The transaction id")
+	_ = trackTxCmd.MarkFlagRequired("txid")
+
+	return trackTxCmd
+}
+
+func (a *App) lightStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "light-status",
+		Short: "Print the header chain and the tracked transactions of the light client",
+		Run: func(cmd *cobra.Command, args []string) {
+			headers, err := blockchain.OpenHeaderStore(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			txs, err := blockchain.LoadTrackedTxs(a.node)
+			if err != nil {
+				cmd.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Best header: %x at height %d\n", headers.Tip(), headers.Height())
+
+			var ids []string
+			for txID := range txs {
+				ids = append(ids, txID)
+			}
+			sort.Strings(ids)
+
+			for _, txID := range ids {
+				proof := txs[txID].Proof
+				if confirmations := headers.Confirmations(proof); confirmations > 0 {
+					fmt.Printf("%s confirmed in block %x (%d confirmations)\n", txID, proof.BlockHash, confirmations)
+				} else {
+					fmt.Printf("%s pending\n", txID)
+				}
+			}
+		},
+	}
+}
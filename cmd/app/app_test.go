@@ -0,0 +1,107 @@
+package app
+
+import (
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sphierex/blockchain-go/internal/blockchain"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain runs the app instead of the tests when the test binary is started
+// by run, each command gets its own process like on the command line.
+func TestMain(m *testing.M) {
+	if os.Getenv("APP_TEST_MAIN") == "1" {
+		if err := New().Execute(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// run executes the app with args in dir on the regtest network and returns
+// its output.
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], append(args, "--node", "3000", "--network", "regtest")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "APP_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+
+	return string(out)
+}
+
+var newAddressRe = regexp.MustCompile(`New address: (\S+)`)
+
+func Test_TransferFromMultiSig(t *testing.T) {
+	dir := t.TempDir()
+	newAddress := func(out string) string {
+		match := newAddressRe.FindStringSubmatch(out)
+		assert.Len(t, match, 2, out)
+		return match[1]
+	}
+
+	alice := newAddress(run(t, dir, "create-wallet"))
+	bob := newAddress(run(t, dir, "create-wallet"))
+	run(t, dir, "create-chain", "--address", alice)
+	multisig := newAddress(run(t, dir, "create-multisig", "--required", "2", "--key", alice, "--key", bob))
+	run(t, dir, "transfer", "--from", alice, "--to", multisig, "--amount", "5", "--mine")
+
+	unsigned := strings.Fields(run(t, dir, "transfer", "--unsigned", "--from", multisig, "--to", bob, "--amount", "3", "--fee", "1"))
+	assert.NotEmpty(t, unsigned)
+	out := run(t, dir, "sign-tx", "--tx", unsigned[len(unsigned)-1])
+	assert.Contains(t, out, "complete: true")
+
+	// mine the signed transaction, the commands have released the chain.
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer func() { _ = os.Chdir(wd) }()
+	assert.NoError(t, blockchain.SelectParams(blockchain.RegTestParams.Name))
+	defer func() { _ = blockchain.SelectParams(blockchain.MainNetParams.Name) }()
+
+	raw, err := hex.DecodeString(strings.Fields(out)[0])
+	assert.NoError(t, err)
+	tx := blockchain.DeserializeTx(raw)
+	bc, err := blockchain.NewBlockchain("3000")
+	assert.NoError(t, err)
+	_, err = bc.Mine([]*blockchain.Transaction{blockchain.NewCoinbaseTx(alice, "", bc.GetBestHeight()+1), &tx})
+	assert.NoError(t, err)
+
+	for address, want := range map[string]int{bob: 3, multisig: 1} {
+		addr, err := blockchain.ValidateAddress(address)
+		assert.NoError(t, err)
+		balance, _ := blockchain.NewUTXOSet(bc).GetBalance(addr)
+		assert.Equal(t, want, balance, address)
+	}
+}
+
+func Test_ReadTxProof(t *testing.T) {
+	tx := blockchain.NewCoinbaseTx(blockchain.NewAccount().String(), "", 1)
+	block := blockchain.NewBlock([]*blockchain.Transaction{tx}, []byte{}, 1, 0)
+	proof, err := block.TxProof(0)
+	assert.NoError(t, err)
+
+	var buf strings.Builder
+	assert.NoError(t, writeTxProof(&buf, proof))
+	path := filepath.Join(t.TempDir(), "proof.json")
+	assert.NoError(t, os.WriteFile(path, []byte(buf.String()), 0600))
+	read, err := readTxProof(path)
+	assert.NoError(t, err)
+	assert.True(t, read.Verify(block.MerkleRoot))
+
+	// hex that isn't a transaction is an error, not an empty transaction.
+	content := strings.Replace(buf.String(), hex.EncodeToString(tx.Serialize()), "00ff", 1)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	_, err = readTxProof(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sphierex/blockchain-go/internal/blockchain"
+)
+
+// writeHistory writes history entries to w in format text, json or csv.
+func writeHistory(w io.Writer, format string, history []blockchain.HistoryEntry) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if history == nil {
+			history = []blockchain.HistoryEntry{}
+		}
+
+		return enc.Encode(history)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"txid", "direction", "counterparties", "amount", "fee", "height", "confirmations", "time"})
+		for _, e := range history {
+			_ = cw.Write([]string{
+				e.TxID,
+				string(e.Direction),
+				strings.Join(e.Counterparties, " "),
+				strconv.Itoa(e.Amount),
+				strconv.Itoa(e.Fee),
+				strconv.Itoa(e.Height),
+				strconv.Itoa(e.Confirmations),
+				time.Unix(e.Timestamp, 0).UTC().Format(time.RFC3339),
+			})
+		}
+		cw.Flush()
+
+		return cw.Error()
+	case "text":
+		for _, e := range history {
+			_, err := fmt.Fprintf(w, "%s %-8s %6d fee %d height %d (%d confirmations) %s\n",
+				e.TxID, e.Direction, e.Amount, e.Fee, e.Height, e.Confirmations, strings.Join(e.Counterparties, ", "))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q, want text, json or csv", format)
+	}
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sphierex/blockchain-go/internal/blockchain"
+)
+
+// parsePayment parses a payment given as address:amount, a bare address is
+// paid amount.
+func parsePayment(s string, amount int) (blockchain.Payment, error) {
+	to, value, found := strings.Cut(s, ":")
+	if !found {
+		return blockchain.Payment{To: to, Amount: amount}, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return blockchain.Payment{}, fmt.Errorf("invalid amount in %q", s)
+	}
+
+	return blockchain.Payment{To: to, Amount: v}, nil
+}
+
+// readPayoutFile reads the payments of a payout file. A .json file holds a list
+// of {"to": address, "amount": amount} objects, any other file is CSV with an
+// address and an amount per line and an optional header line.
+func readPayoutFile(path string) ([]blockchain.Payment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var payments []blockchain.Payment
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&payments); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		return payments, nil
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		amount, err := strconv.Atoi(record[1])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: invalid amount %q", path, line, record[1])
+		}
+		payments = append(payments, blockchain.Payment{To: record[0], Amount: amount})
+	}
+
+	return payments, nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sphierex/blockchain-go/internal/blockchain"
+	"github.com/sphierex/blockchain-go/pkg/merkle"
+)
+
+// txProofFile is the portable form of a transaction inclusion proof.
+type txProofFile struct {
+	Block      string            `json:"block"`
+	Height     int               `json:"height"`
+	MerkleRoot string            `json:"merkle_root"`
+	Tx         string            `json:"tx"`
+	Index      int               `json:"index"`
+	TxCount    int               `json:"tx_count"`
+	Path       []txProofStepFile `json:"path"`
+}
+
+type txProofStepFile struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+// writeTxProof writes proof to w as json.
+func writeTxProof(w io.Writer, proof *blockchain.TxProof) error {
+	file := txProofFile{
+		Block:      hex.EncodeToString(proof.BlockHash),
+		Height:     proof.Height,
+		MerkleRoot: hex.EncodeToString(proof.MerkleRoot),
+		Tx:         hex.EncodeToString(proof.Tx.Serialize()),
+		Index:      proof.Index,
+		TxCount:    proof.TxCount,
+		Path:       []txProofStepFile{},
+	}
+	for _, step := range proof.Path {
+		file.Path = append(file.Path, txProofStepFile{Hash: hex.EncodeToString(step.Hash), Left: step.Left})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(file)
+}
+
+// readTxProof reads a proof written by writeTxProof.
+func readTxProof(path string) (*blockchain.TxProof, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file txProofFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	proof := &blockchain.TxProof{Height: file.Height, Index: file.Index, TxCount: file.TxCount}
+	if proof.BlockHash, err = hex.DecodeString(file.Block); err != nil {
+		return nil, fmt.Errorf("block hash is not valid: %w", err)
+	}
+	if proof.MerkleRoot, err = hex.DecodeString(file.MerkleRoot); err != nil {
+		return nil, fmt.Errorf("merkle root is not valid: %w", err)
+	}
+
+	txData, err := hex.DecodeString(file.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("transaction is not valid: %w", err)
+	}
+	if proof.Tx, err = blockchain.ParseTx(txData); err != nil {
+		return nil, err
+	}
+
+	for _, step := range file.Path {
+		hash, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("proof hash is not valid: %w", err)
+		}
+		proof.Path = append(proof.Path, merkle.ProofStep{Hash: hash, Left: step.Left})
+	}
+
+	return proof, nil
+}
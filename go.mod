@@ -1,6 +1,6 @@
 module github.com/sphierex/blockchain-go
 
-go 1.18
+go 1.22
 
 require (
 	github.com/spf13/cobra v1.8.1
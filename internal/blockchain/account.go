@@ -6,6 +6,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 
 	"golang.org/x/crypto/ripemd160"
@@ -14,10 +15,59 @@ import (
 )
 
 const (
-	accountVersion     = byte(0x00)
 	accountChecksumLen = 4
+	addressHashLen     = 20
 )
 
+var ErrInvalidAddress = errors.New("address is not valid")
+
+// AddressKind identifies what an address commits to.
+type AddressKind int
+
+const (
+	// PubKeyHashAddress pays to the hash of a public key.
+	PubKeyHashAddress AddressKind = iota
+	// ScriptHashAddress pays to the hash of a redeem script.
+	ScriptHashAddress
+)
+
+func (k AddressKind) String() string {
+	switch k {
+	case PubKeyHashAddress:
+		return "pubkeyhash"
+	case ScriptHashAddress:
+		return "scripthash"
+	default:
+		return "unknown"
+	}
+}
+
+// Address is a decoded and validated address.
+type Address struct {
+	Kind    AddressKind
+	Version byte
+	Hash    []byte
+}
+
+// String returns the Base58Check encoding of the address.
+func (a *Address) String() string {
+	return string(encodeAddress(a.Version, a.Hash))
+}
+
+// Script returns the locking script that pays to the address.
+func (a *Address) Script() []byte {
+	if a.Kind == ScriptHashAddress {
+		return NewP2SHScript(a.Hash)
+	}
+
+	return NewP2PKHScript(a.Hash)
+}
+
+// NewScriptHashAddress returns the P2SH address committing to redeemScript.
+func NewScriptHashAddress(redeemScript []byte) string {
+	return string(encodeAddress(activeParams.ScriptHashAddrID, HashPubKey(redeemScript)))
+}
+
 // Account stores private and public keys.
 type Account struct {
 	PrivateKey ecdsa.PrivateKey
@@ -36,14 +86,50 @@ func NewAccount() *Account {
 	return &account
 }
 
+// Keyring finds the keys and redeem scripts needed to sign transaction inputs.
+type Keyring interface {
+	// FindKey returns the private key whose public key hashes to pubKeyHash.
+	FindKey(pubKeyHash []byte) (*ecdsa.PrivateKey, bool)
+	// FindScript returns the redeem script hashing to scriptHash.
+	FindScript(scriptHash []byte) ([]byte, bool)
+}
+
+// FindKey returns the account private key when it matches pubKeyHash.
+func (a *Account) FindKey(pubKeyHash []byte) (*ecdsa.PrivateKey, bool) {
+	if !bytes.Equal(HashPubKey(a.PublicKey), pubKeyHash) {
+		return nil, false
+	}
+
+	return &a.PrivateKey, true
+}
+
+// FindScript returns false, an account holds no redeem scripts.
+func (a *Account) FindScript(scriptHash []byte) ([]byte, bool) {
+	return nil, false
+}
+
+// accountKeyring is a Keyring of several accounts.
+type accountKeyring []*Account
+
+func (k accountKeyring) FindKey(pubKeyHash []byte) (*ecdsa.PrivateKey, bool) {
+	for _, account := range k {
+		if key, ok := account.FindKey(pubKeyHash); ok {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (k accountKeyring) FindScript(scriptHash []byte) ([]byte, bool) {
+	return nil, false
+}
+
 // Address returns account address.
 func (a *Account) Address() []byte {
 	pubKeyHash := HashPubKey(a.PublicKey)
 
-	versionPayload := append([]byte{accountVersion}, pubKeyHash...)
-	payload := append(versionPayload, checksum(versionPayload)...)
-
-	return base58.Encode(payload)
+	return encodeAddress(activeParams.PubKeyHashAddrID, pubKeyHash)
 }
 
 func (a *Account) String() string {
@@ -61,19 +147,43 @@ func HashPubKey(pubKey []byte) []byte {
 	return pubRIPEMD160
 }
 
-// ValidateAddress check if address is valid.
-func ValidateAddress(address string) bool {
-	if len(address) != 34 {
-		return false
+// ValidateAddress check if address is valid and returns its decoded form.
+func ValidateAddress(address string) (*Address, error) {
+	payload := base58.Decode([]byte(address))
+	if len(payload) != 1+addressHashLen+accountChecksumLen {
+		return nil, ErrInvalidAddress
 	}
 
-	pubKeyHash := base58.Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-accountChecksumLen:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-accountChecksumLen]
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
+	actualChecksum := payload[len(payload)-accountChecksumLen:]
+	versionPayload := payload[:len(payload)-accountChecksumLen]
+	if !bytes.Equal(actualChecksum, checksum(versionPayload)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidAddress)
+	}
+
+	addr := &Address{Version: versionPayload[0], Hash: versionPayload[1:]}
+	switch addr.Version {
+	case activeParams.PubKeyHashAddrID:
+		addr.Kind = PubKeyHashAddress
+	case activeParams.ScriptHashAddrID:
+		addr.Kind = ScriptHashAddress
+	default:
+		for _, params := range registeredParams {
+			if addr.Version == params.PubKeyHashAddrID || addr.Version == params.ScriptHashAddrID {
+				return nil, fmt.Errorf("%w: address belongs to the %s network", ErrInvalidAddress, params.Name)
+			}
+		}
+		return nil, fmt.Errorf("%w: unknown version 0x%02x", ErrInvalidAddress, addr.Version)
+	}
 
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+	return addr, nil
+}
+
+// encodeAddress returns the Base58Check encoding of version and hash.
+func encodeAddress(version byte, hash []byte) []byte {
+	versionPayload := append([]byte{version}, hash...)
+	payload := append(versionPayload, checksum(versionPayload)...)
+
+	return base58.Encode(payload)
 }
 
 // Checksum generates a checksum for a public key
@@ -87,7 +197,6 @@ func checksum(payload []byte) []byte {
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	curve := elliptic.P256()
 	private, _ := ecdsa.GenerateKey(curve, rand.Reader)
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
 
-	return *private, pubKey
+	return *private, pubKeyBytes(&private.PublicKey)
 }
@@ -0,0 +1,119 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateAddress(t *testing.T) {
+	account := NewAccount()
+
+	addr, err := ValidateAddress(account.String())
+	assert.NoError(t, err)
+	assert.Equal(t, PubKeyHashAddress, addr.Kind)
+	assert.Equal(t, HashPubKey(account.PublicKey), addr.Hash)
+	assert.Equal(t, account.String(), addr.String())
+
+	scriptAddress := NewScriptHashAddress([]byte{opDup})
+	addr, err = ValidateAddress(scriptAddress)
+	assert.NoError(t, err)
+	assert.Equal(t, ScriptHashAddress, addr.Kind)
+	assert.Equal(t, byte('3'), scriptAddress[0])
+
+	_, err = ValidateAddress(string(encodeAddress(0x42, addr.Hash)))
+	assert.ErrorIs(t, err, ErrInvalidAddress, "unknown version byte")
+
+	corrupted := []byte(account.String())
+	corrupted[len(corrupted)-1]++
+	_, err = ValidateAddress(string(corrupted))
+	assert.ErrorIs(t, err, ErrInvalidAddress, "bad checksum")
+
+	_, err = ValidateAddress("not an address")
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func Test_ValidateAddressNetwork(t *testing.T) {
+	defer func() { _ = SelectParams(MainNetParams.Name) }()
+
+	assert.NoError(t, SelectParams(TestNetParams.Name))
+	testAddress := NewAccount().String()
+	_, err := ValidateAddress(testAddress)
+	assert.NoError(t, err)
+
+	assert.NoError(t, SelectParams(MainNetParams.Name))
+	_, err = ValidateAddress(testAddress)
+	assert.ErrorIs(t, err, ErrInvalidAddress, "a test network address must not be accepted on main")
+
+	assert.Error(t, SelectParams("nonexistent"))
+}
+
+func Test_WalletKeyring(t *testing.T) {
+	w := &Wallet{Accounts: make(map[string]*Account), Scripts: make(map[string][]byte)}
+	a := w.Accounts[w.NewAccount()]
+	b := w.Accounts[w.NewAccount()]
+
+	redeemScript, err := NewMultiSigScript(2, [][]byte{a.PublicKey, b.PublicKey})
+	assert.NoError(t, err)
+	w.AddScript(redeemScript)
+
+	key, ok := w.FindKey(HashPubKey(b.PublicKey))
+	assert.True(t, ok)
+	assert.Equal(t, &b.PrivateKey, key)
+
+	_, ok = a.FindKey(HashPubKey(b.PublicKey))
+	assert.False(t, ok, "an account only holds its own key")
+
+	script, ok := w.FindScript(HashPubKey(redeemScript))
+	assert.True(t, ok)
+	assert.Equal(t, redeemScript, script)
+
+	hashes := classifyScript(redeemScript).pubKeyHashes()
+	assert.Equal(t, [][]byte{HashPubKey(a.PublicKey), HashPubKey(b.PublicKey)}, hashes)
+}
+
+func Test_OutputAddress(t *testing.T) {
+	account := NewAccount()
+	assert.Equal(t, account.String(), NewTxOutput(1, account.String()).Address())
+
+	scriptAddress := NewScriptHashAddress([]byte{op1})
+	assert.Equal(t, scriptAddress, NewTxOutput(1, scriptAddress).Address())
+
+	multiSig, err := NewMultiSigTxOutput(1, 1, [][]byte{account.PublicKey})
+	assert.NoError(t, err)
+	assert.Empty(t, multiSig.Address(), "bare multisig outputs have no address")
+}
+
+func Test_WIF(t *testing.T) {
+	defer func() { _ = SelectParams(MainNetParams.Name) }()
+
+	account := NewAccount()
+	wif := account.WIF()
+	assert.Equal(t, byte('5'), wif[0], "main network keys start with 5")
+
+	imported, err := DecodeWIF(wif)
+	assert.NoError(t, err)
+	assert.Equal(t, account.String(), imported.String())
+	assert.Equal(t, 0, account.PrivateKey.D.Cmp(imported.PrivateKey.D))
+
+	corrupted := []byte(wif)
+	corrupted[len(corrupted)-1]++
+	_, err = DecodeWIF(string(corrupted))
+	assert.ErrorIs(t, err, ErrInvalidWIF)
+
+	assert.NoError(t, SelectParams(TestNetParams.Name))
+	_, err = DecodeWIF(wif)
+	assert.ErrorIs(t, err, ErrInvalidWIF, "a main network key must not be accepted on test")
+}
+
+func Test_SignMessage(t *testing.T) {
+	account, other := NewAccount(), NewAccount()
+
+	signature, err := account.SignMessage("I own this address")
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyMessage(account.String(), signature, "I own this address"))
+
+	assert.ErrorIs(t, VerifyMessage(account.String(), signature, "I own that address"), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifyMessage(other.String(), signature, "I own this address"), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifyMessage(account.String(), "bm90IGEgc2lnbmF0dXJl", "I own this address"), ErrInvalidSignature)
+}
@@ -2,32 +2,102 @@ package blockchain
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
+	"fmt"
 	"time"
 
 	"github.com/sphierex/blockchain-go/pkg/merkle"
 )
 
+const (
+	// blockVersion is the version of the blocks mined by this node.
+	blockVersion int32 = 1
+
+	// BlockHeaderLen is the size of a serialized block header.
+	BlockHeaderLen = 4 + 2*sha256.Size + 8 + 4 + 4
+	// nonceOffset is where the nonce is in a serialized block header.
+	nonceOffset = BlockHeaderLen - 4
+)
+
+// BlockHeader holds the fields the hash of a block commits to, the
+// transactions are committed through the merkle root.
+type BlockHeader struct {
+	Version       int32
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Timestamp     int64
+	// Bits is the number of leading zero bits the block hash must have.
+	Bits  uint32
+	Nonce uint32
+}
+
+// Serialize returns the header in its fixed layout: version, previous block
+// hash, merkle root, timestamp, bits and nonce, integers in little endian.
+// The genesis block has no previous block, its hash is all zeros.
+func (h *BlockHeader) Serialize() []byte {
+	data := make([]byte, BlockHeaderLen)
+	binary.LittleEndian.PutUint32(data, uint32(h.Version))
+	copy(data[4:4+sha256.Size], h.PrevBlockHash)
+	copy(data[4+sha256.Size:4+2*sha256.Size], h.MerkleRoot)
+	binary.LittleEndian.PutUint64(data[4+2*sha256.Size:], uint64(h.Timestamp))
+	binary.LittleEndian.PutUint32(data[12+2*sha256.Size:], h.Bits)
+	binary.LittleEndian.PutUint32(data[nonceOffset:], h.Nonce)
+
+	return data
+}
+
+// DeserializeBlockHeader parses a header serialized by Serialize.
+func DeserializeBlockHeader(data []byte) (BlockHeader, error) {
+	if len(data) != BlockHeaderLen {
+		return BlockHeader{}, fmt.Errorf("block header is %d bytes, want %d", len(data), BlockHeaderLen)
+	}
+
+	h := BlockHeader{
+		Version:       int32(binary.LittleEndian.Uint32(data)),
+		PrevBlockHash: append([]byte{}, data[4:4+sha256.Size]...),
+		MerkleRoot:    append([]byte{}, data[4+sha256.Size:4+2*sha256.Size]...),
+		Timestamp:     int64(binary.LittleEndian.Uint64(data[4+2*sha256.Size:])),
+		Bits:          binary.LittleEndian.Uint32(data[12+2*sha256.Size:]),
+		Nonce:         binary.LittleEndian.Uint32(data[nonceOffset:]),
+	}
+	if bytes.Equal(h.PrevBlockHash, make([]byte, sha256.Size)) {
+		h.PrevBlockHash = []byte{}
+	}
+
+	return h, nil
+}
+
+// Hash returns the hash of the block the header belongs to.
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
 // Block represents a block in the blockchain.
 type Block struct {
-	Timestamp     int64
-	Transactions  []*Transaction
-	PrevBlockHash []byte
-	Hash          []byte
-	Nonce         int
-	Height        int
+	BlockHeader
+	Transactions []*Transaction
+	Hash         []byte
+	Height       int
 }
 
-// NewBlock creates and returns Block.
-func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int) *Block {
+// NewBlock creates and returns Block stamped with timestamp.
+func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int, timestamp int64) *Block {
 	block := &Block{
-		Timestamp:     time.Now().Unix(),
-		Transactions:  transactions,
-		PrevBlockHash: prevBlockHash,
-		Hash:          []byte{},
-		Nonce:         0,
-		Height:        height,
+		BlockHeader: BlockHeader{
+			Version:       blockVersion,
+			PrevBlockHash: prevBlockHash,
+			Timestamp:     timestamp,
+			Bits:          uint32(activeParams.PowLimitBits),
+		},
+		Transactions: transactions,
+		Height:       height,
 	}
+	// the merkle root is computed once, mining only hashes the header.
+	block.MerkleRoot = block.HashTransactions()
 
 	pow := NewProofOfWork(block)
 	nonce, hash := pow.Run()
@@ -39,19 +109,23 @@ func NewBlock(transactions []*Transaction, prevBlockHash []byte, height int) *Bl
 
 // NewGenesisBlock creates and returns genesis Block.
 func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{}, 0)
+	return NewBlock([]*Transaction{coinbase}, []byte{}, 0, time.Now().Unix())
 }
 
 // HashTransactions returns a hash of the transactions in the block.
 func (block *Block) HashTransactions() []byte {
+	return block.merkleTree().RootNode.Data
+}
+
+// merkleTree builds the merkle tree of the transactions in the block.
+func (block *Block) merkleTree() *merkle.MerkleTree {
 	var transactions [][]byte
 
 	for _, tx := range block.Transactions {
-		transactions = append(transactions, tx.Serialize())
+		transactions = append(transactions, tx.HashData())
 	}
-	mTree := merkle.New(transactions)
 
-	return mTree.RootNode.Data
+	return merkle.New(transactions)
 }
 
 // Serialize serializes the block.
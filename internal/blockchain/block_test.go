@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BlockHeader(t *testing.T) {
+	defer func() { _ = SelectParams(MainNetParams.Name) }()
+	assert.NoError(t, SelectParams(RegTestParams.Name))
+
+	coinbase := NewCoinbaseTx(NewAccount().String(), "", 0)
+	block := NewGenesisBlock(coinbase)
+
+	data := block.BlockHeader.Serialize()
+	assert.Len(t, data, BlockHeaderLen)
+	assert.Equal(t, block.Hash, block.BlockHeader.Hash())
+	assert.NoError(t, checkBlock(block))
+
+	h, err := DeserializeBlockHeader(data)
+	assert.NoError(t, err)
+	assert.Equal(t, block.BlockHeader, h)
+
+	block.Transactions = append(block.Transactions, NewCoinbaseTx(NewAccount().String(), "", 0))
+	assert.ErrorIs(t, checkBlock(block), ErrBadMerkle, "the header commits to the transactions")
+}
+
+func Test_CheckCoinbase(t *testing.T) {
+	to := NewAccount().String()
+	coinbase := NewCoinbaseTx(to, "fixed", 7)
+	assert.NoError(t, checkCoinbase([]*Transaction{coinbase}, 7))
+	assert.ErrorIs(t, checkCoinbase([]*Transaction{coinbase}, 8), ErrBadHeight)
+	assert.ErrorIs(t, checkCoinbase([]*Transaction{coinbase, coinbase}, 7), ErrCoinbase)
+	assert.ErrorIs(t, checkCoinbase(nil, 7), ErrCoinbase)
+	assert.NotEqual(t, coinbase.ID, NewCoinbaseTx(to, "fixed", 8).ID, "the height makes coinbase ids unique")
+
+	view := func(txID []byte) (TxOutputs, bool) {
+		return TxOutputs{}, bytes.Equal(txID, coinbase.ID)
+	}
+	assert.ErrorIs(t, checkDuplicateTxs(view, []*Transaction{coinbase}), ErrDuplicate)
+	assert.NoError(t, checkDuplicateTxs(view, []*Transaction{NewCoinbaseTx(to, "fixed", 8)}))
+}
+
+func Test_CheckSpends(t *testing.T) {
+	to := NewAccount().String()
+	prev := []byte("prev")
+	view := func(txID []byte) (TxOutputs, bool) {
+		return TxOutputs{Values: []TxOutput{{Value: 5}}, Indexes: []int{0}}, bytes.Equal(txID, prev)
+	}
+	spend := func(id string, from []byte, value int) *Transaction {
+		return &Transaction{ID: []byte(id), Vin: []TxInput{{TxId: from}}, Vout: []TxOutput{{Value: value}}}
+	}
+
+	coinbase := NewCoinbaseTx(to, "", 1)
+	assert.NoError(t, checkSpends(view, []*Transaction{coinbase, spend("a", prev, 4), spend("b", []byte("a"), 4)}, 1))
+	assert.ErrorIs(t, checkSpends(view, []*Transaction{coinbase, spend("a", prev, 4), spend("b", prev, 4)}, 1), ErrSpentTwice)
+	assert.ErrorIs(t, checkSpends(view, []*Transaction{coinbase, spend("a", []byte("gone"), 4)}, 1), ErrMissingInput)
+	assert.ErrorIs(t, checkSpends(view, []*Transaction{coinbase, spend("a", prev, 6)}, 1), ErrOverspend)
+
+	coinbase.Vout[0].Value++
+	assert.NoError(t, checkSpends(view, []*Transaction{coinbase, spend("a", prev, 4)}, 1), "the fees go to the miner")
+	assert.ErrorIs(t, checkSpends(view, []*Transaction{coinbase}, 1), ErrBadReward)
+}
+
+func Test_TransactionHashData(t *testing.T) {
+	script := NewP2PKHScript(make([]byte, 20))
+	tx := &Transaction{
+		ID:       []byte{9},
+		Vin:      []TxInput{{TxId: []byte{1}, Vout: 2, Sequence: MaxTxInSequenceNum}},
+		Vout:     []TxOutput{{Value: 3, ScriptPubKey: script}},
+		LockTime: 4,
+	}
+
+	want := []byte{1, 1, 1, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 1, 3, 0, 0, 0, 0, 0, 0, 0, byte(len(script))}
+	want = append(want, script...)
+	want = append(want, 4, 0, 0, 0, 0, 0, 0, 0)
+	assert.Equal(t, want, tx.HashData())
+
+	// the id is not hashed.
+	hash := sha256.Sum256(want)
+	tx.ID = nil
+	assert.Equal(t, hash[:], tx.Hash())
+}
+
+func Test_TxProof(t *testing.T) {
+	owner := NewAccount().String()
+	var txs []*Transaction
+	for i := 0; i < 3; i++ {
+		txs = append(txs, NewCoinbaseTx(owner, "", i))
+	}
+	block := NewBlock(txs, []byte{}, 0, 0)
+
+	for i := range txs {
+		proof, err := block.TxProof(i)
+		assert.NoError(t, err)
+		assert.True(t, proof.Verify(block.MerkleRoot), "proof of tx %d", i)
+	}
+
+	proof, err := block.TxProof(1)
+	assert.NoError(t, err)
+	proof.Index = 0
+	assert.False(t, proof.Verify(block.MerkleRoot), "the proof is bound to the index")
+	proof.Index, proof.TxCount = 1, 5
+	assert.False(t, proof.Verify(block.MerkleRoot), "the path is as long as the tree is deep")
+}
@@ -8,29 +8,46 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"go.etcd.io/bbolt"
 )
 
 const (
-	dbFilename          = "zblock/dbs/blockchain_%s.db"
-	blocksBucket        = "blocks"
-	genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
-	latestHashKey       = "latest"
+	dbFilename    = "zblock/dbs/blockchain_%s.db"
+	blocksBucket  = "blocks"
+	latestHashKey = "latest"
+	versionKey    = "version"
+
+	// chainVersion is the format of the stored blocks. Bump it when a
+	// change to the transactions or blocks makes existing chains unreadable
+	// or changes their hashes: 2 added scripts and lock times to transactions
+	// and hashes them from a fixed layout instead of gob.
+	chainVersion = 2
 )
 
 // Blockchain implements interactions with a DB.
 type Blockchain struct {
 	tip []byte
 	db  *bbolt.DB
+
+	// timeSource is the network adjusted time blocks are checked and
+	// stamped with.
+	timeSource *MedianTime
+
+	// headers is the header chain synced ahead of the blocks to tell the
+	// ancestors of the assume-valid block, nil when the node doesn't sync it.
+	headersMu sync.Mutex
+	headers   *HeaderStore
 }
 
 // CreateBlockchain creates a new blockchain DB.
 func CreateBlockchain(node, address string) (*Blockchain, error) {
 	var tip []byte
-	dbPath := fmt.Sprintf(dbFilename, node)
+	dbPath := activeParams.dataFile(dbFilename, node)
 	if _, err := os.Stat(dbPath); err != nil && os.IsExist(err) {
 		return nil, fmt.Errorf("blockchain file %s exists", dbPath)
 	}
@@ -47,7 +64,7 @@ func CreateBlockchain(node, address string) (*Blockchain, error) {
 		}
 
 		// create genesis block.
-		cTx := NewCoinbaseTx(address, genesisCoinbaseData)
+		cTx := NewCoinbaseTx(address, activeParams.GenesisCoinbaseData, 0)
 		genesis := NewGenesisBlock(cTx)
 		err = b.Put(genesis.Hash, genesis.Serialize())
 		if err != nil {
@@ -60,6 +77,11 @@ func CreateBlockchain(node, address string) (*Blockchain, error) {
 			return err
 		}
 
+		err = b.Put([]byte(versionKey), []byte{chainVersion})
+		if err != nil {
+			return err
+		}
+
 		tip = genesis.Hash
 		return nil
 	})
@@ -69,15 +91,16 @@ func CreateBlockchain(node, address string) (*Blockchain, error) {
 	}
 
 	return &Blockchain{
-		tip: tip,
-		db:  db,
+		tip:        tip,
+		db:         db,
+		timeSource: NewMedianTime(),
 	}, nil
 }
 
 // NewBlockchain creates a new Blockchain with genesis Block.
 func NewBlockchain(node string) (*Blockchain, error) {
 	var tip []byte
-	dbPath := fmt.Sprintf(dbFilename, node)
+	dbPath := activeParams.dataFile(dbFilename, node)
 	if _, err := os.Stat(dbPath); err != nil && os.IsNotExist(err) {
 		return nil, fmt.Errorf("blockchain file %s not exists", dbPath)
 	}
@@ -90,18 +113,23 @@ func NewBlockchain(node string) (*Blockchain, error) {
 	// get latest block hash.
 	err = db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
+		if v := b.Get([]byte(versionKey)); len(v) != 1 || v[0] != chainVersion {
+			return fmt.Errorf("blockchain file %s has an old format, remove it and create or sync the chain again", dbPath)
+		}
 		tip = b.Get([]byte(latestHashKey))
 
 		return nil
 	})
 
 	if err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return &Blockchain{
-		tip: tip,
-		db:  db,
+		tip:        tip,
+		db:         db,
+		timeSource: NewMedianTime(),
 	}, nil
 }
 
@@ -140,6 +168,18 @@ func (bc *Blockchain) T() {
 
 // Submit saves the block into the blockchain.
 func (bc *Blockchain) Submit(block *Block) error {
+	if err := checkBlock(block); err != nil {
+		return err
+	}
+	if _, err := bc.getBlockByKey(block.Hash); err == nil {
+		// the block is known, its transactions are already in the chain.
+		return nil
+	}
+	if err := bc.checkBlockContext(block); err != nil {
+		return err
+	}
+
+	newTip, extendsTip := false, false
 	err := bc.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		exists := b.Get(block.Hash)
@@ -162,29 +202,78 @@ func (bc *Blockchain) Submit(block *Block) error {
 				return err
 			}
 			bc.tip = block.Hash
+			newTip = true
+			extendsTip = bytes.Equal(block.PrevBlockHash, latestHash)
 		}
 
 		return nil
 	})
+	if err != nil || !newTip {
+		return err
+	}
+
+	// the chain state follows the tip block by block, so the next block is
+	// checked against it.
+	if extendsTip {
+		return NewUTXOSet(bc).Update(block)
+	}
 
-	return err
+	return NewUTXOSet(bc).Rebuild()
 }
 
 // Mine mines a new block with the provided transactions.
 func (bc *Blockchain) Mine(txs []*Transaction) (*Block, error) {
+	latestBlock, err := bc.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCoinbase(txs, latestBlock.Height+1); err != nil {
+		return nil, err
+	}
 
+	size := 0
 	for _, tx := range txs {
-		if bc.VerifyTx(tx) != true {
-			return nil, fmt.Errorf("invlid transaction")
+		if err := checkTxSanity(tx); err != nil {
+			return nil, err
 		}
+		size += len(tx.Serialize())
+	}
+	if size > activeParams.MaxBlockSize-blockReservedSize {
+		return nil, fmt.Errorf("%w: transactions are %d bytes, max %d", ErrOversize, size, activeParams.MaxBlockSize-blockReservedSize)
 	}
 
-	latestBlock, err := bc.latest()
+	// blocks mined within the same second still move past the median.
+	medianTimePast, err := bc.medianTimePast(latestBlock.Hash)
 	if err != nil {
 		return nil, err
 	}
+	timestamp := max(bc.timeSource.Now(), medianTimePast+1)
+
+	if err := bc.checkCoinbaseSpends(txs, latestBlock.Hash, latestBlock.Height+1); err != nil {
+		return nil, err
+	}
+	view := bc.viewAt(latestBlock.Hash)
+	if err := checkDuplicateTxs(view, txs); err != nil {
+		return nil, err
+	}
+	if err := checkSpends(view, txs, latestBlock.Height+1); err != nil {
+		return nil, err
+	}
+
+	// transactions may spend outputs of the ones before them in the block.
+	parents := make(map[string]*Transaction)
+	for _, tx := range txs {
+		if bc.VerifyTxWithParents(tx, parents) != true {
+			return nil, fmt.Errorf("invlid transaction")
+		}
+		parents[hex.EncodeToString(tx.ID)] = tx
+		if !tx.IsFinal(latestBlock.Height+1, medianTimePast) {
+			return nil, fmt.Errorf("%w: %x", ErrTxNotFinal, tx.ID)
+		}
+	}
 
-	block := NewBlock(txs, latestBlock.Hash, latestBlock.Height+1)
+	block := NewBlock(txs, latestBlock.Hash, latestBlock.Height+1, timestamp)
 
 	err = bc.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
@@ -206,6 +295,10 @@ func (bc *Blockchain) Mine(txs []*Transaction) (*Block, error) {
 		return nil, err
 	}
 
+	if err := NewUTXOSet(bc).Update(block); err != nil {
+		return nil, err
+	}
+
 	return block, nil
 }
 
@@ -227,6 +320,48 @@ func (bc *Blockchain) latestHash() []byte {
 	return latestHash
 }
 
+// connectedSince returns the blocks the best chain gained since its tip was
+// the block hash, oldest first. After a reorg they start at the fork point.
+func (bc *Blockchain) connectedSince(hash []byte) ([]*Block, error) {
+	old, err := bc.getBlockByKey(hash)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := bc.getBlockByKey(bc.latestHash())
+	if err != nil {
+		return nil, err
+	}
+
+	var connected []*Block
+	for !bytes.Equal(old.Hash, tip.Hash) {
+		if tip.Height >= old.Height {
+			connected = append(connected, tip)
+			if tip, err = bc.getBlockByKey(tip.PrevBlockHash); err != nil {
+				return nil, err
+			}
+		}
+		if old.Height > tip.Height || (old.Height == tip.Height && !bytes.Equal(old.Hash, tip.Hash)) {
+			if old, err = bc.getBlockByKey(old.PrevBlockHash); err != nil {
+				return nil, err
+			}
+		}
+	}
+	slices.Reverse(connected)
+
+	return connected, nil
+}
+
+// genesisHash returns the hash of the stored genesis block.
+func (bc *Blockchain) genesisHash() []byte {
+	var hash []byte
+	_ = bc.Foreach(func(block *Block) error {
+		hash = block.Hash
+		return nil
+	})
+
+	return hash
+}
+
 // getBlockByKey retrieve blocks through cache key
 func (bc *Blockchain) getBlockByKey(key []byte) (*Block, error) {
 	var block *Block
@@ -304,10 +439,15 @@ func (bc *Blockchain) GetTransactionById(id []byte) (Transaction, error) {
 
 // GetUTXO get all unspent transaction outputs and returns transactions with spent outputs removed.
 func (bc *Blockchain) GetUTXO() map[string]TxOutputs {
+	return bc.unspentOutputsAt(bc.tip)
+}
+
+// unspentOutputsAt returns the outputs unspent on top of the block hash.
+func (bc *Blockchain) unspentOutputsAt(hash []byte) map[string]TxOutputs {
 	result := make(map[string]TxOutputs)
 	spentTxOutputs := make(map[string][]int)
 
-	_ = bc.Foreach(func(block *Block) error {
+	_ = bc.foreachFrom(hash, func(block *Block) error {
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
 		outputs:
@@ -322,6 +462,9 @@ func (bc *Blockchain) GetUTXO() map[string]TxOutputs {
 
 				outs := result[txID]
 				outs.Values = append(outs.Values, out)
+				outs.Indexes = append(outs.Indexes, outIdx)
+				outs.Height = block.Height
+				outs.Coinbase = tx.IsCoinbase()
 				result[txID] = outs
 			}
 			if tx.IsCoinbase() == false {
@@ -338,8 +481,10 @@ func (bc *Blockchain) GetUTXO() map[string]TxOutputs {
 	return result
 }
 
-// SignTx signs inputs of a Transaction
-func (bc *Blockchain) SignTx(tx *Transaction, privateKey ecdsa.PrivateKey) error {
+// SignTx signs inputs of a Transaction, each with the keys of keys that the
+// output it spends is locked with. Pay-to-script-hash inputs get their redeem
+// script from keys when they don't carry one yet.
+func (bc *Blockchain) SignTx(tx *Transaction, keys Keyring) error {
 	prevTxs := make(map[string]Transaction)
 
 	for _, v := range tx.Vin {
@@ -351,17 +496,62 @@ func (bc *Blockchain) SignTx(tx *Transaction, privateKey ecdsa.PrivateKey) error
 		prevTxs[hex.EncodeToString(prevTx.ID)] = prevTx
 	}
 
-	return tx.Sign(privateKey, prevTxs)
+	var privateKeys []*ecdsa.PrivateKey
+	seen := make(map[*ecdsa.PrivateKey]bool)
+	for i, v := range tx.Vin {
+		if err := checkPrevOutput(v, prevTxs); err != nil {
+			return err
+		}
+
+		info := classifyScript(prevTxs[hex.EncodeToString(v.TxId)].Vout[v.Vout].ScriptPubKey)
+		if info.Class == scriptHashTy {
+			if redeemScript, ok := keys.FindScript(info.ScriptHash); ok && len(v.ScriptSig) == 0 {
+				tx.SetRedeemScript(i, redeemScript)
+			}
+
+			data, _ := pushedData(tx.Vin[i].ScriptSig)
+			if len(data) == 0 {
+				continue
+			}
+			info = classifyScript(data[len(data)-1])
+		}
+
+		for _, pubKeyHash := range info.pubKeyHashes() {
+			if key, ok := keys.FindKey(pubKeyHash); ok && !seen[key] {
+				seen[key] = true
+				privateKeys = append(privateKeys, key)
+			}
+		}
+	}
+
+	for _, privateKey := range privateKeys {
+		if err := tx.Sign(*privateKey, prevTxs); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // VerifyTx verifies transaction input signatures
 func (bc *Blockchain) VerifyTx(tx *Transaction) bool {
+	return bc.VerifyTxWithParents(tx, nil)
+}
+
+// VerifyTxWithParents verifies transaction input signatures, the spent
+// transactions are looked up in the unconfirmed parents before the blockchain.
+func (bc *Blockchain) VerifyTxWithParents(tx *Transaction, parents map[string]*Transaction) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
 
 	prevTxs := make(map[string]Transaction)
 	for _, v := range tx.Vin {
+		if parent, ok := parents[hex.EncodeToString(v.TxId)]; ok {
+			prevTxs[hex.EncodeToString(parent.ID)] = *parent
+			continue
+		}
+
 		prevTx, err := bc.GetTransactionById(v.TxId)
 		if err != nil {
 			return false
@@ -375,8 +565,14 @@ func (bc *Blockchain) VerifyTx(tx *Transaction) bool {
 }
 
 func (bc *Blockchain) Foreach(fn func(*Block) error) error {
+	return bc.foreachFrom(bc.tip, fn)
+}
+
+// foreachFrom calls fn with the block hash and its ancestors, down to the
+// genesis block.
+func (bc *Blockchain) foreachFrom(hash []byte, fn func(*Block) error) error {
 	i := &iterator{
-		current: bc.tip,
+		current: hash,
 		db:      bc.db,
 	}
 
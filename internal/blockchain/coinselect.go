@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// bnbMaxTries bounds the branch-and-bound search.
+const bnbMaxTries = 100000
+
+var ErrInsufficientFunds = errors.New("not enough funds")
+
+// Coin is an unspent output that can be spent by a new transaction.
+type Coin struct {
+	TxId  []byte
+	Vout  int
+	Value int
+}
+
+// CoinSelector picks coins worth at least target out of coins. Coins below
+// dust are never picked.
+type CoinSelector func(coins []Coin, target, dust int) ([]Coin, error)
+
+var coinSelectors = []struct {
+	name     string
+	selector CoinSelector
+}{
+	{"bnb", BranchAndBound},
+	{"largest-first", LargestFirst},
+	{"random-improve", RandomImprove},
+}
+
+// CoinSelectorByName returns the coin selection strategy called name.
+func CoinSelectorByName(name string) (CoinSelector, error) {
+	var names []string
+	for _, s := range coinSelectors {
+		if s.name == name {
+			return s.selector, nil
+		}
+		names = append(names, s.name)
+	}
+
+	return nil, fmt.Errorf("unknown coin selection %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// spendableCoins returns the coins at least worth dust, largest first.
+func spendableCoins(coins []Coin, dust int) []Coin {
+	var result []Coin
+	for _, coin := range coins {
+		if coin.Value >= dust {
+			result = append(result, coin)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Value > result[j].Value
+	})
+
+	return result
+}
+
+// LargestFirst spends the largest coins until target is reached, it keeps the
+// number of inputs low.
+func LargestFirst(coins []Coin, target, dust int) ([]Coin, error) {
+	var selected []Coin
+	total := 0
+
+	for _, coin := range spendableCoins(coins, dust) {
+		if total >= target {
+			break
+		}
+		selected = append(selected, coin)
+		total += coin.Value
+	}
+
+	if total < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	return selected, nil
+}
+
+// BranchAndBound searches for coins summing to target without creating change,
+// anything left below dust is given to the miner. It falls back to
+// LargestFirst when there is no such match.
+func BranchAndBound(coins []Coin, target, dust int) ([]Coin, error) {
+	spendable := spendableCoins(coins, dust)
+
+	// remaining[i] is the value of the coins from i on.
+	remaining := make([]int, len(spendable)+1)
+	for i := len(spendable) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + spendable[i].Value
+	}
+
+	upper := target + dust
+	if dust < 1 {
+		upper = target + 1
+	}
+
+	var best, current []int
+	bestWaste, tries := -1, 0
+
+	var search func(i, total int)
+	search = func(i, total int) {
+		tries++
+		if tries > bnbMaxTries || total >= upper || total+remaining[i] < target {
+			return
+		}
+		if total >= target {
+			if waste := total - target; bestWaste < 0 || waste < bestWaste {
+				bestWaste = waste
+				best = append(best[:0], current...)
+			}
+			return
+		}
+		if i == len(spendable) {
+			return
+		}
+
+		current = append(current, i)
+		search(i+1, total+spendable[i].Value)
+		current = current[:len(current)-1]
+		search(i+1, total)
+	}
+	search(0, 0)
+
+	if bestWaste < 0 {
+		return LargestFirst(coins, target, dust)
+	}
+
+	selected := make([]Coin, 0, len(best))
+	for _, i := range best {
+		selected = append(selected, spendable[i])
+	}
+
+	return selected, nil
+}
+
+// RandomImprove picks random coins until target is reached, then keeps adding
+// random coins while that brings the total closer to twice the target, so the
+// change is about the size of the payment and stays useful for later ones.
+func RandomImprove(coins []Coin, target, dust int) ([]Coin, error) {
+	spendable := spendableCoins(coins, dust)
+	rand.Shuffle(len(spendable), func(i, j int) {
+		spendable[i], spendable[j] = spendable[j], spendable[i]
+	})
+
+	var selected []Coin
+	total, i := 0, 0
+	for ; i < len(spendable) && total < target; i++ {
+		selected = append(selected, spendable[i])
+		total += spendable[i].Value
+	}
+	if total < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	ideal, limit := 2*target, 3*target
+	for ; i < len(spendable); i++ {
+		next := total + spendable[i].Value
+		if next > limit || distance(next, ideal) >= distance(total, ideal) {
+			continue
+		}
+		selected = append(selected, spendable[i])
+		total = next
+	}
+
+	return selected, nil
+}
+
+// distance returns the absolute difference of a and b.
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func coinValues(coins []Coin) []int {
+	var values []int
+	for _, coin := range coins {
+		values = append(values, coin.Value)
+	}
+
+	return values
+}
+
+func Test_CoinSelection(t *testing.T) {
+	coins := []Coin{{Vout: 0, Value: 1}, {Vout: 1, Value: 7}, {Vout: 2, Value: 3}, {Vout: 3, Value: 5}, {Vout: 4, Value: 1}}
+
+	selected, err := LargestFirst(coins, 9, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{7, 5}, coinValues(selected))
+
+	selected, err = BranchAndBound(coins, 8, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{7, 1}, coinValues(selected), "exact match without change")
+
+	selected, err = BranchAndBound(coins, 8, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{5, 3}, coinValues(selected), "dust coins are not spent")
+
+	selected, err = BranchAndBound(coins, 14, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{7, 5, 3}, coinValues(selected), "falls back to largest first")
+
+	for i := 0; i < 20; i++ {
+		selected, err = RandomImprove(coins, 4, 1)
+		assert.NoError(t, err)
+
+		total := 0
+		for _, v := range coinValues(selected) {
+			total += v
+		}
+		assert.GreaterOrEqual(t, total, 4)
+		assert.LessOrEqual(t, total, 12)
+	}
+
+	_, err = LargestFirst(coins, 18, 1)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = BranchAndBound(coins, 16, 2)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	_, err = CoinSelectorByName("smallest-first")
+	assert.Error(t, err)
+}
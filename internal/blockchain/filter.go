@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"os"
+
+	"github.com/sphierex/blockchain-go/pkg/bloom"
+)
+
+// filterFPRate is the false positive rate of the filters light clients load,
+// the extra matches hide which transactions are theirs.
+const filterFPRate = 0.0001
+
+// outpointKey returns the filter element of an output.
+func outpointKey(txID []byte, vout int) []byte {
+	key := make([]byte, len(txID)+4)
+	copy(key, txID)
+	binary.LittleEndian.PutUint32(key[len(txID):], uint32(vout))
+
+	return key
+}
+
+// scriptPushes returns the data pushed by a script, or nothing when it can't
+// be parsed.
+func scriptPushes(script []byte) [][]byte {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil
+	}
+
+	var data [][]byte
+	for _, o := range ops {
+		if len(o.data) > 0 {
+			data = append(data, o.data)
+		}
+	}
+
+	return data
+}
+
+// matchTx checks whether tx is relevant to a filter: its id, data pushed by
+// one of its scripts, or an output it spends is in the filter. The outputs of
+// a matching transaction are added to the filter so their spends match too.
+func matchTx(f *bloom.Filter, tx *Transaction) bool {
+	matched := f.Contains(tx.ID)
+	for i, out := range tx.Vout {
+		for _, data := range scriptPushes(out.ScriptPubKey) {
+			if f.Contains(data) {
+				matched = true
+				f.Add(outpointKey(tx.ID, i))
+				break
+			}
+		}
+	}
+	if matched {
+		return true
+	}
+
+	for _, in := range tx.Vin {
+		if f.Contains(outpointKey(in.TxId, in.Vout)) {
+			return true
+		}
+		for _, data := range scriptPushes(in.ScriptSig) {
+			if f.Contains(data) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// walletFilter returns a filter matching the transactions of the wallet and
+// the transactions tracked by the light client node.
+func walletFilter(node string) (*bloom.Filter, error) {
+	var elements [][]byte
+
+	wallet, err := NewWallet(node)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, address := range wallet.GetAddresses() {
+		addr, err := ValidateAddress(address)
+		if err != nil {
+			continue
+		}
+		elements = append(elements, addr.Hash)
+		if pubKey, ok := wallet.GetPubKey(address); ok {
+			elements = append(elements, pubKey)
+		}
+	}
+
+	txs, err := LoadTrackedTxs(node)
+	if err != nil {
+		return nil, err
+	}
+	for txID := range txs {
+		id, _ := hex.DecodeString(txID)
+		elements = append(elements, id)
+	}
+
+	f := bloom.New(len(elements), filterFPRate, rand.Uint32())
+	for _, element := range elements {
+		f.Add(element)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sphierex/blockchain-go/pkg/bloom"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MatchTx(t *testing.T) {
+	ours, theirs := NewAccount(), NewAccount()
+
+	f := bloom.New(10, 0.0001, 0)
+	f.Add(HashPubKey(ours.PublicKey))
+
+	payment := &Transaction{ID: []byte{1}, Vout: []TxOutput{{Value: 5, ScriptPubKey: NewP2PKHScript(HashPubKey(ours.PublicKey))}}}
+	other := &Transaction{ID: []byte{2}, Vout: []TxOutput{{Value: 5, ScriptPubKey: NewP2PKHScript(HashPubKey(theirs.PublicKey))}}}
+	spend := &Transaction{ID: []byte{3}, Vin: []TxInput{{TxId: []byte{1}, Vout: 0}}, Vout: other.Vout}
+
+	assert.False(t, matchTx(f, spend), "the payment isn't known yet")
+	assert.True(t, matchTx(f, payment))
+	assert.False(t, matchTx(f, other))
+	assert.True(t, matchTx(f, spend), "spends of matched outputs match")
+}
+
+func Test_AddOrphan(t *testing.T) {
+	s, err := openHeaderFile(filepath.Join(t.TempDir(), "headers.dat"))
+	assert.NoError(t, err)
+	c := &LightClient{headers: s}
+	proof := func(height int) *TxProof {
+		return &TxProof{Height: height, Tx: &Transaction{ID: []byte{byte(height)}}}
+	}
+
+	c.addOrphan("a", proof(maxOrphanDistance+1))
+	assert.Empty(t, c.orphans, "too far past the best header")
+
+	for i := 0; i < maxPeerOrphanProofs+1; i++ {
+		c.addOrphan("a", proof(1))
+	}
+	assert.Len(t, c.orphans, maxPeerOrphanProofs, "a peer gets a share of the pool")
+
+	for i := 0; i < maxOrphanProofs; i++ {
+		c.addOrphan(fmt.Sprintf("peer%d", i), proof(2))
+	}
+	assert.Len(t, c.orphans, maxOrphanProofs)
+	assert.Equal(t, "peer0", c.orphans[0].from, "the oldest proofs make room")
+}
+
+func Test_FilterLoadNeedsHandshake(t *testing.T) {
+	bc := newTestChain(t, NewAccount())
+	n := NewServerWithBlockchain(bc, "23001", "")
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 50000}
+
+	peer := "localhost:23002"
+	load := append(cmdToBytes(FilterLoadCmd), encode(filterLoadReq{FromAddr: peer, Filter: *bloom.New(10, 0.0001, 0)})...)
+	version := append(cmdToBytes(VersionCmd), encode(versionReq{Version: nodeVersion, FromAddr: peer, Timestamp: time.Now().Unix()})...)
+
+	n.handleFilterLoad(load, local)
+	assert.Empty(t, n.filters, "the peer sent no version")
+
+	n.handleVersion(version, remote)
+	n.handleFilterLoad(load, remote)
+	assert.Empty(t, n.filters, "another host claimed the peer")
+
+	n.handleVersion(version, local)
+	n.handleFilterLoad(load, remote)
+	assert.Empty(t, n.filters, "another host loads a filter for the peer")
+	n.handleFilterLoad(load, local)
+	assert.Contains(t, n.filters, peer)
+}
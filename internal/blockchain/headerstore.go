@@ -0,0 +1,273 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	headersFilename = "zblock/dbs/headers_%s.dat"
+	// maxHeadersPerMsg bounds the headers sent in one message.
+	maxHeadersPerMsg = 2000
+)
+
+var ErrHeaderLink = errors.New("header does not connect to the chain")
+
+// HeaderStore keeps the headers of the best chain known to a light client in
+// a file of serialized headers, the height of a header is its position.
+type HeaderStore struct {
+	path    string
+	headers []BlockHeader
+	hashes  [][]byte
+
+	// timeSource is the network adjusted time headers are checked with.
+	timeSource *MedianTime
+}
+
+// OpenHeaderStore loads the headers of node, the store is empty when there is
+// no header file yet.
+func OpenHeaderStore(node string) (*HeaderStore, error) {
+	return openHeaderFile(activeParams.dataFile(headersFilename, node))
+}
+
+func openHeaderFile(path string) (*HeaderStore, error) {
+	s := &HeaderStore{path: path, timeSource: NewMedianTime()}
+
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(content)%BlockHeaderLen != 0 {
+		// a crash while appending leaves a partial record behind.
+		content = content[:len(content)-len(content)%BlockHeaderLen]
+		if err := os.Truncate(s.path, int64(len(content))); err != nil {
+			return nil, err
+		}
+	}
+
+	for len(content) > 0 {
+		h, err := DeserializeBlockHeader(content[:BlockHeaderLen])
+		if err != nil {
+			return nil, err
+		}
+		s.headers = append(s.headers, h)
+		s.hashes = append(s.hashes, h.Hash())
+		content = content[BlockHeaderLen:]
+	}
+
+	return s, nil
+}
+
+// Height returns the height of the best header, -1 when the store is empty.
+func (s *HeaderStore) Height() int {
+	return len(s.headers) - 1
+}
+
+// Tip returns the hash of the best header.
+func (s *HeaderStore) Tip() []byte {
+	if len(s.hashes) == 0 {
+		return nil
+	}
+
+	return s.hashes[len(s.hashes)-1]
+}
+
+// Header returns the header at height and its hash.
+func (s *HeaderStore) Header(height int) (BlockHeader, []byte, bool) {
+	if height < 0 || height >= len(s.headers) {
+		return BlockHeader{}, nil, false
+	}
+
+	return s.headers[height], s.hashes[height], true
+}
+
+// Locator returns hashes of the best chain, densely near the tip and then
+// exponentially sparser, for a peer to find the last header both know.
+func (s *HeaderStore) Locator() [][]byte {
+	var locator [][]byte
+	step := 1
+	for height := s.Height(); height >= 0; height -= step {
+		locator = append(locator, s.hashes[height])
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+
+	return locator
+}
+
+// Connect adds headers starting at height start. They must carry valid proof
+// of work, be stamped after the median time past, match the checkpoints and
+// link to each other and to the header before start. A batch
+// forking off the stored chain only replaces it when it ends higher. Connect
+// returns the number of headers added.
+func (s *HeaderStore) Connect(start int, headers []BlockHeader) (int, error) {
+	if start < 0 || start > len(s.headers) {
+		return 0, fmt.Errorf("%w: starts at height %d, best is %d", ErrHeaderLink, start, s.Height())
+	}
+
+	var prevHash []byte
+	if start > 0 {
+		prevHash = s.hashes[start-1]
+	}
+	// the timestamps of the chain the headers extend.
+	var timestamps []int64
+	for _, h := range s.headers[max(0, start-medianTimeBlocks):start] {
+		timestamps = append(timestamps, h.Timestamp)
+	}
+	now := s.timeSource.Now()
+
+	hashes := make([][]byte, len(headers))
+	for i := range headers {
+		h := &headers[i]
+		hashes[i] = h.Hash()
+
+		if err := checkHeader(h); err != nil {
+			return 0, fmt.Errorf("header %x: %w", hashes[i], err)
+		}
+		if !bytes.Equal(h.PrevBlockHash, prevHash) {
+			return 0, fmt.Errorf("%w: header %x at height %d", ErrHeaderLink, hashes[i], start+i)
+		}
+		// a fork below a checkpoint can't get past it.
+		if cp, ok := activeParams.checkpoint(start + i); ok && !bytes.Equal(cp.Hash, hashes[i]) {
+			return 0, fmt.Errorf("%w: header %x at height %d", ErrCheckpoint, hashes[i], start+i)
+		}
+		if start+i > 0 {
+			medianTimePast := medianTimestamp(timestamps[max(0, len(timestamps)-medianTimeBlocks):])
+			if err := checkBlockTime(h, medianTimePast, now); err != nil {
+				return 0, fmt.Errorf("header %x: %w", hashes[i], err)
+			}
+		}
+		prevHash = hashes[i]
+		timestamps = append(timestamps, h.Timestamp)
+	}
+
+	// skip the headers already stored.
+	known := 0
+	for known < len(headers) && start+known < len(s.headers) && bytes.Equal(hashes[known], s.hashes[start+known]) {
+		known++
+	}
+	if known == len(headers) {
+		return 0, nil
+	}
+	headers, hashes, start = headers[known:], hashes[known:], start+known
+
+	if start < len(s.headers) {
+		if start+len(headers) <= len(s.headers) {
+			// a fork that isn't longer than the best chain.
+			return 0, nil
+		}
+
+		s.headers, s.hashes = s.headers[:start], s.hashes[:start]
+		s.headers = append(s.headers, headers...)
+		s.hashes = append(s.hashes, hashes...)
+
+		return len(headers), s.rewrite()
+	}
+
+	if err := s.append(headers); err != nil {
+		return 0, err
+	}
+	s.headers = append(s.headers, headers...)
+	s.hashes = append(s.hashes, hashes...)
+
+	return len(headers), nil
+}
+
+// append writes headers at the end of the header file.
+func (s *HeaderStore) append(headers []BlockHeader) error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for i := range headers {
+		buf.Write(headers[i].Serialize())
+	}
+	if _, err := io.Copy(f, &buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// rewrite replaces the header file with the stored headers after a reorg.
+func (s *HeaderStore) rewrite() error {
+	var buf bytes.Buffer
+	for i := range s.headers {
+		buf.Write(s.headers[i].Serialize())
+	}
+
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+// openHeaders opens the header chain of node when an assume-valid block is
+// set, the node syncs it ahead of the blocks.
+func (bc *Blockchain) openHeaders(node string) error {
+	if activeParams.AssumeValid == nil {
+		return nil
+	}
+
+	headers, err := OpenHeaderStore(node)
+	if err != nil {
+		return err
+	}
+	headers.timeSource = bc.timeSource
+	bc.headers = headers
+
+	return nil
+}
+
+// headersHeight returns the height of the header chain.
+func (bc *Blockchain) headersHeight() int {
+	bc.headersMu.Lock()
+	defer bc.headersMu.Unlock()
+
+	return bc.headers.Height()
+}
+
+// Headers returns up to max headers of the best chain following the first
+// locator hash found in it, or from the genesis block when none is found,
+// and the height of the first one.
+func (bc *Blockchain) Headers(locator [][]byte, max int) (int, []BlockHeader, error) {
+	var blocks []*Block
+	err := bc.Foreach(func(block *Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// blocks go from the tip down to the genesis block.
+	start := 0
+	heights := make(map[string]int)
+	for _, block := range blocks {
+		heights[string(block.Hash)] = block.Height
+	}
+	for _, hash := range locator {
+		if height, ok := heights[string(hash)]; ok {
+			start = height + 1
+			break
+		}
+	}
+
+	var headers []BlockHeader
+	for i := len(blocks) - 1 - start; i >= 0 && len(headers) < max; i-- {
+		headers = append(headers, blocks[i].BlockHeader)
+	}
+
+	return start, headers, nil
+}
@@ -0,0 +1,127 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mineHeaders returns n headers on top of prev with a valid proof of work,
+// stamped after the headers of the lower tags.
+func mineHeaders(prev []byte, n int, tag byte) []BlockHeader {
+	var headers []BlockHeader
+	for i := 0; i < n; i++ {
+		root := sha256.Sum256([]byte{tag, byte(i)})
+		h := BlockHeader{PrevBlockHash: prev, MerkleRoot: root[:], Timestamp: int64(tag)<<16 + int64(i), Bits: uint32(activeParams.PowLimitBits)}
+		mineHeader(&h)
+		headers = append(headers, h)
+		prev = h.Hash()
+	}
+
+	return headers
+}
+
+// mineHeader finds the nonce of h.
+func mineHeader(h *BlockHeader) {
+	for h.Nonce = 0; !checkPoW(h.Hash()); h.Nonce++ {
+	}
+}
+
+func Test_HeaderStore(t *testing.T) {
+	defer func() { _ = SelectParams(MainNetParams.Name) }()
+	assert.NoError(t, SelectParams(RegTestParams.Name))
+
+	path := filepath.Join(t.TempDir(), "headers.dat")
+	s, err := openHeaderFile(path)
+	assert.NoError(t, err)
+
+	chain := mineHeaders([]byte{}, 4, 1)
+	added, err := s.Connect(0, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, added)
+	assert.Equal(t, 3, s.Height())
+
+	added, err = s.Connect(2, chain[2:])
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added, "known headers are skipped")
+
+	_, err = s.Connect(4, mineHeaders(make([]byte, sha256.Size), 1, 2))
+	assert.ErrorIs(t, err, ErrHeaderLink)
+
+	bad := mineHeaders(s.Tip(), 1, 3)
+	bad[0].Nonce++
+	for checkPoW(bad[0].Hash()) {
+		bad[0].Nonce++
+	}
+	_, err = s.Connect(4, bad)
+	assert.ErrorIs(t, err, ErrInvalidPoW)
+
+	_, hash, _ := s.Header(1)
+	added, err = s.Connect(2, mineHeaders(hash, 2, 4))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added, "a fork as long as the best chain is ignored")
+
+	fork := mineHeaders(hash, 3, 5)
+	added, err = s.Connect(2, fork)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, added, "a longer fork replaces the best chain")
+	assert.Equal(t, fork[2].Hash(), s.Tip())
+
+	stale := mineHeaders(s.Tip(), 1, 6)
+	stale[0].Timestamp = fork[0].Timestamp // the median of the five headers.
+	mineHeader(&stale[0])
+	_, err = s.Connect(5, stale)
+	assert.ErrorIs(t, err, ErrTimeTooOld)
+
+	stale[0].Timestamp = time.Now().Unix() + maxFutureBlockTime + 60
+	mineHeader(&stale[0])
+	_, err = s.Connect(5, stale)
+	assert.ErrorIs(t, err, ErrTimeTooNew)
+
+	reopened, err := openHeaderFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, s.Tip(), reopened.Tip())
+	assert.Equal(t, 4, reopened.Height())
+}
+
+func Test_Checkpoints(t *testing.T) {
+	defer func() { _ = SelectParams(MainNetParams.Name) }()
+	assert.NoError(t, SelectParams(RegTestParams.Name))
+	defer func() { RegTestParams.Checkpoints, RegTestParams.AssumeValid = nil, nil }()
+
+	chain := mineHeaders([]byte{}, 3, 1)
+	cp, err := ParseCheckpoint(fmt.Sprintf("1:%x", chain[1].Hash()))
+	assert.NoError(t, err)
+	AddCheckpoint(cp)
+	_, err = ParseCheckpoint("1")
+	assert.Error(t, err)
+
+	s, err := openHeaderFile(filepath.Join(t.TempDir(), "headers.dat"))
+	assert.NoError(t, err)
+	_, err = s.Connect(0, mineHeaders([]byte{}, 2, 2))
+	assert.ErrorIs(t, err, ErrCheckpoint)
+	added, err := s.Connect(0, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, added)
+
+	assert.NoError(t, checkCheckpoint(3, []byte{3}, 2))
+	assert.ErrorIs(t, checkCheckpoint(1, []byte{1}, 0), ErrCheckpoint, "the hash differs")
+	assert.ErrorIs(t, checkCheckpoint(0, []byte{0}, 2), ErrCheckpoint, "a fork below the checkpoint")
+
+	block := func(h BlockHeader, height int) *Block {
+		return &Block{BlockHeader: h, Hash: h.Hash(), Height: height}
+	}
+	bc := &Blockchain{headers: s}
+	SetAssumeValid(Checkpoint{Height: 2, Hash: chain[2].Hash()})
+	assert.True(t, bc.assumedValid(block(chain[1], 1)))
+	assert.False(t, bc.assumedValid(block(mineHeaders(chain[0].Hash(), 1, 2)[0], 1)), "not an ancestor")
+	assert.False(t, (&Blockchain{}).assumedValid(block(chain[1], 1)), "no header chain")
+	SetAssumeValid(Checkpoint{Height: 3, Hash: []byte{3}})
+	assert.False(t, bc.assumedValid(block(chain[1], 1)), "the assume-valid header is unknown")
+	last, _ := activeParams.lastCheckpoint()
+	assert.Equal(t, 3, last.Height)
+}
@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"sort"
+)
+
+// Direction tells how a transaction moved funds of the wallet.
+type Direction string
+
+const (
+	// Received transactions pay to the wallet without spending from it.
+	Received Direction = "received"
+	// Sent transactions spend from the wallet and pay someone else.
+	Sent Direction = "sent"
+	// Self transactions spend from the wallet and only pay back to it.
+	Self Direction = "self"
+)
+
+// coinbaseCounterparty is the counterparty of newly mined coins.
+const coinbaseCounterparty = "coinbase"
+
+// HistoryEntry describes a confirmed transaction touching a set of addresses.
+// Amount is the value received, or the value paid to the counterparties when
+// sending. Fee is only set for transactions the addresses paid for.
+type HistoryEntry struct {
+	TxID           string
+	Direction      Direction
+	Counterparties []string
+	Amount         int
+	Fee            int
+	Height         int
+	Confirmations  int
+	Timestamp      int64
+}
+
+// Address returns the address the output pays to, or an empty string when
+// its script has no address.
+func (to *TxOutput) Address() string {
+	info := classifyScript(to.ScriptPubKey)
+	switch info.Class {
+	case pubKeyHashTy, lockTimeTy:
+		return string(encodeAddress(activeParams.PubKeyHashAddrID, info.PubKeyHash))
+	case scriptHashTy:
+		return string(encodeAddress(activeParams.ScriptHashAddrID, info.ScriptHash))
+	default:
+		return ""
+	}
+}
+
+// History scans the blockchain for the transactions paying to or spending from
+// any of addresses, oldest first.
+func (bc *Blockchain) History(addresses []*Address) ([]HistoryEntry, error) {
+	var blocks []*Block
+	err := bc.Foreach(func(block *Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Height < blocks[j].Height
+	})
+
+	owned := func(out *TxOutput) bool {
+		for _, address := range addresses {
+			if out.IsLockedWithAddress(address) {
+				return true
+			}
+		}
+		return false
+	}
+
+	bestHeight := bc.GetBestHeight()
+	txs := make(map[string]*Transaction)
+	var history []HistoryEntry
+
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			txs[hex.EncodeToString(tx.ID)] = tx
+
+			entry := HistoryEntry{
+				TxID:          hex.EncodeToString(tx.ID),
+				Height:        block.Height,
+				Confirmations: bestHeight - block.Height + 1,
+				Timestamp:     block.Timestamp,
+			}
+
+			spent, inputs, senders := 0, 0, make(map[string]bool)
+			if tx.IsCoinbase() {
+				senders[coinbaseCounterparty] = true
+			} else {
+				for _, in := range tx.Vin {
+					prevTx, ok := txs[hex.EncodeToString(in.TxId)]
+					if !ok || in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+						continue
+					}
+
+					prevOut := &prevTx.Vout[in.Vout]
+					inputs += prevOut.Value
+					if owned(prevOut) {
+						spent += prevOut.Value
+					} else if address := prevOut.Address(); address != "" {
+						senders[address] = true
+					}
+				}
+			}
+
+			received, paid, outputs := 0, 0, 0
+			recipients := make(map[string]bool)
+			for i := range tx.Vout {
+				out := &tx.Vout[i]
+				outputs += out.Value
+				if owned(out) {
+					received += out.Value
+				} else {
+					paid += out.Value
+					if address := out.Address(); address != "" {
+						recipients[address] = true
+					}
+				}
+			}
+
+			switch {
+			case spent > 0 && paid > 0:
+				entry.Direction, entry.Amount = Sent, paid
+				entry.Counterparties = sortedKeys(recipients)
+			case spent > 0:
+				entry.Direction = Self
+			case received > 0:
+				entry.Direction, entry.Amount = Received, received
+				entry.Counterparties = sortedKeys(senders)
+			default:
+				continue
+			}
+			if spent > 0 {
+				entry.Fee = inputs - outputs
+			}
+
+			history = append(history, entry)
+		}
+	}
+
+	return history, nil
+}
+
+// sortedKeys returns the keys of a set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTimeOffset bounds how far the clocks of the peers may move the
+	// adjusted time away from the local clock.
+	maxTimeOffset = 70 * 60
+	// minTimeSamples is the number of peers needed before their clocks are
+	// trusted over the local one.
+	minTimeSamples = 5
+	// maxTimeSamples bounds the peers sampled.
+	maxTimeSamples = 200
+)
+
+// MedianTime is the network adjusted time: the local clock moved by the
+// median offset of the clocks the peers reported in their version messages.
+type MedianTime struct {
+	mu      sync.Mutex
+	offsets map[string]int64
+	offset  int64
+}
+
+// NewMedianTime returns an adjusted time following the local clock until
+// enough peers are sampled.
+func NewMedianTime() *MedianTime {
+	return &MedianTime{offsets: make(map[string]int64)}
+}
+
+// AddSample records the time reported by peer, each peer is sampled once so
+// a single one can't move the median.
+func (m *MedianTime) AddSample(peer string, timestamp int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.offsets[peer]; ok || len(m.offsets) >= maxTimeSamples {
+		return
+	}
+	m.offsets[peer] = timestamp - time.Now().Unix()
+	if len(m.offsets) < minTimeSamples {
+		return
+	}
+
+	offsets := make([]int64, 0, len(m.offsets))
+	for _, offset := range m.offsets {
+		offsets = append(offsets, offset)
+	}
+	median := medianTimestamp(offsets)
+	if median < -maxTimeOffset || median > maxTimeOffset {
+		// peers this far off are more likely wrong than the local clock.
+		log.Printf("Peers' clocks are %d seconds off, check the local clock\n", median)
+		median = 0
+	}
+	m.offset = median
+}
+
+// Offset returns the seconds added to the local clock.
+func (m *MedianTime) Offset() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.offset
+}
+
+// Now returns the network adjusted time.
+func (m *MedianTime) Now() int64 {
+	return time.Now().Unix() + m.Offset()
+}
+
+// medianTimestamp returns the median of timestamps, the upper one when their
+// number is even.
+func medianTimestamp(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sorted := slices.Clone(timestamps)
+	slices.Sort(sorted)
+
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,29 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MedianTime(t *testing.T) {
+	assert.Equal(t, int64(3), medianTimestamp([]int64{5, 1, 3}))
+	assert.Equal(t, int64(0), medianTimestamp(nil))
+
+	m := NewMedianTime()
+	now := time.Now().Unix()
+	for _, peer := range []string{"a", "b", "c", "d"} {
+		m.AddSample(peer, now+600)
+	}
+	assert.Equal(t, int64(0), m.Offset(), "too few peers")
+
+	m.AddSample("a", now+6000)
+	m.AddSample("e", now+600)
+	assert.InDelta(t, 600, m.Offset(), 2, "each peer is sampled once")
+
+	for _, peer := range []string{"f", "g", "h", "i", "j", "k"} {
+		m.AddSample(peer, now+maxTimeOffset+600)
+	}
+	assert.Equal(t, int64(0), m.Offset(), "offsets past the bound are ignored")
+}
@@ -0,0 +1,417 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// blockReservedSize is the part of a block left for the header, the
+	// coinbase and the encoding when filling it with pooled transactions.
+	blockReservedSize = 10000
+	// incrementalRelayFee is the fee per started kilobyte a replacement pays
+	// on top of the fees it evicts, for the bandwidth of relaying it.
+	incrementalRelayFee = 1
+)
+
+var (
+	ErrTxHeld          = errors.New("transaction is held until it is final")
+	ErrTxConflict      = errors.New("transaction conflicts with a non-replaceable transaction")
+	ErrInsufficientFee = errors.New("replacement does not pay enough fee")
+)
+
+// mempoolEntry is a transaction in the pool with the fee it pays and its
+// links to the pooled transactions it spends from and that spend from it.
+type mempoolEntry struct {
+	tx       *Transaction
+	fee      int
+	size     int
+	parents  map[string]bool
+	children map[string]bool
+}
+
+// Mempool holds the transactions waiting to be mined. Transactions that are
+// not final yet are parked until the chain reaches their lock time.
+// Transactions signalling replacement can be replaced by a conflicting one
+// paying a higher fee. Transactions may spend the outputs of pooled ones, the
+// block template then selects whole packages by their ancestor fee rate.
+type Mempool struct {
+	mu      sync.Mutex
+	txs     map[string]*mempoolEntry
+	pending map[string]*mempoolEntry
+	spent   map[string]string
+}
+
+// NewMempool returns an empty Mempool.
+func NewMempool() *Mempool {
+	return &Mempool{
+		txs:     make(map[string]*mempoolEntry),
+		pending: make(map[string]*mempoolEntry),
+		spent:   make(map[string]string),
+	}
+}
+
+// outpoint returns the key of an output spent by an input.
+func outpoint(in TxInput) string {
+	return fmt.Sprintf("%x:%d", in.TxId, in.Vout)
+}
+
+// Add adds a transaction paying fee that would be mined in a block at height
+// after blocks with medianTimePast, and returns the transactions it replaced. It returns
+// ErrTxHeld when the transaction is parked because it, or a pooled
+// transaction it spends from, isn't final yet.
+func (m *Mempool) Add(tx *Transaction, fee int, height int, medianTimePast int64) ([]*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txID := hex.EncodeToString(tx.ID)
+	if m.entry(txID) != nil {
+		return nil, nil
+	}
+
+	size := len(tx.Serialize())
+
+	// a replacement evicts the conflicting transactions and everything
+	// spending from them.
+	evicted := make(map[string]*mempoolEntry)
+	var conflicts []*mempoolEntry
+	for _, in := range tx.Vin {
+		id, ok := m.spent[outpoint(in)]
+		if !ok {
+			continue
+		}
+
+		conflict := m.entry(id)
+		if !conflict.tx.SignalsReplacement() {
+			return nil, fmt.Errorf("%w: %x", ErrTxConflict, conflict.tx.ID)
+		}
+		conflicts = append(conflicts, conflict)
+		m.descendants(id, evicted)
+	}
+
+	if len(evicted) > 0 {
+		evictedFee := 0
+		for _, entry := range evicted {
+			evictedFee += entry.fee
+		}
+		if minFee := evictedFee + incrementalRelayFee*((size+999)/1000); fee < minFee {
+			return nil, fmt.Errorf("%w: %d, min %d", ErrInsufficientFee, fee, minFee)
+		}
+		// a larger replacement can't pay a lower rate than what it replaces.
+		for _, conflict := range conflicts {
+			if fee*conflict.size < conflict.fee*size {
+				return nil, fmt.Errorf("%w: fee rate is lower than %x", ErrInsufficientFee, conflict.tx.ID)
+			}
+		}
+	}
+
+	entry := &mempoolEntry{
+		tx:       tx,
+		fee:      fee,
+		size:     size,
+		parents:  make(map[string]bool),
+		children: make(map[string]bool),
+	}
+	for _, in := range tx.Vin {
+		parentID := hex.EncodeToString(in.TxId)
+		if m.entry(parentID) == nil {
+			continue
+		}
+		if evicted[parentID] != nil {
+			return nil, fmt.Errorf("%w: spends from a transaction it replaces", ErrTxConflict)
+		}
+		entry.parents[parentID] = true
+	}
+
+	var replaced []*Transaction
+	for id, e := range evicted {
+		m.remove(id)
+		replaced = append(replaced, e.tx)
+	}
+
+	for parentID := range entry.parents {
+		m.entry(parentID).children[txID] = true
+	}
+	for _, in := range tx.Vin {
+		m.spent[outpoint(in)] = txID
+	}
+
+	if !m.mineable(entry, height, medianTimePast) {
+		m.pending[txID] = entry
+		return replaced, ErrTxHeld
+	}
+	m.txs[txID] = entry
+
+	return replaced, nil
+}
+
+// entry returns a pooled or parked entry by transaction id.
+func (m *Mempool) entry(txID string) *mempoolEntry {
+	if entry, ok := m.txs[txID]; ok {
+		return entry
+	}
+
+	return m.pending[txID]
+}
+
+// mineable checks whether an entry is final and none of the pooled
+// transactions it spends from is parked.
+func (m *Mempool) mineable(entry *mempoolEntry, height int, medianTimePast int64) bool {
+	if !entry.tx.IsFinal(height, medianTimePast) {
+		return false
+	}
+
+	for parentID := range entry.parents {
+		if m.txs[parentID] == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// descendants adds the entry txID and every pooled transaction spending from
+// it to result.
+func (m *Mempool) descendants(txID string, result map[string]*mempoolEntry) {
+	entry := m.entry(txID)
+	if entry == nil || result[txID] != nil {
+		return
+	}
+
+	result[txID] = entry
+	for childID := range entry.children {
+		m.descendants(childID, result)
+	}
+}
+
+// ancestors adds every pooled transaction the entry txID spends from,
+// directly or through other pooled transactions, to result.
+func (m *Mempool) ancestors(txID string, result map[string]*mempoolEntry) {
+	for parentID := range m.entry(txID).parents {
+		if result[parentID] == nil {
+			result[parentID] = m.entry(parentID)
+			m.ancestors(parentID, result)
+		}
+	}
+}
+
+// Promote moves the parked transactions that became final for a block at
+// height after blocks with medianTimePast into the pool and returns them.
+func (m *Mempool) Promote(height int, medianTimePast int64) []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// promoting a parent can make its parked children mineable.
+	var promoted []*Transaction
+	for changed := true; changed; {
+		changed = false
+		for txID, entry := range m.pending {
+			if m.mineable(entry, height, medianTimePast) {
+				delete(m.pending, txID)
+				m.txs[txID] = entry
+				promoted = append(promoted, entry.tx)
+				changed = true
+			}
+		}
+	}
+
+	return promoted
+}
+
+// Has checks whether the transaction is in the pool or parked.
+func (m *Mempool) Has(id []byte) bool {
+	_, ok := m.Get(id)
+
+	return ok
+}
+
+// Get returns a transaction from the pool or the parked ones.
+func (m *Mempool) Get(id []byte) (*Transaction, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entry(hex.EncodeToString(id))
+	if entry == nil {
+		return nil, false
+	}
+
+	return entry.tx, true
+}
+
+// Parents returns the pooled or parked transactions tx spends from, by id.
+func (m *Mempool) Parents(tx *Transaction) map[string]*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parents := make(map[string]*Transaction)
+	for _, in := range tx.Vin {
+		parentID := hex.EncodeToString(in.TxId)
+		if entry := m.entry(parentID); entry != nil {
+			parents[parentID] = entry.tx
+		}
+	}
+
+	return parents
+}
+
+// Fee returns the fee paid by a pooled or parked transaction.
+func (m *Mempool) Fee(id []byte) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entry(hex.EncodeToString(id))
+	if entry == nil {
+		return 0, false
+	}
+
+	return entry.fee, true
+}
+
+// Transactions returns the transactions that can be mined.
+func (m *Mempool) Transactions() []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs := make([]*Transaction, 0, len(m.txs))
+	for _, entry := range m.txs {
+		txs = append(txs, entry.tx)
+	}
+
+	return txs
+}
+
+// Count returns the number of transactions that can be mined.
+func (m *Mempool) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.txs)
+}
+
+// BlockTemplate selects the transactions of the next block, up to maxSize
+// serialized bytes. Each round picks
+// the transaction whose package, itself and its unselected ancestors, pays the
+// highest fee rate, so a child paying a high fee pulls in a low-fee parent.
+// Parents always come before their children.
+func (m *Mempool) BlockTemplate(maxSize int) []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var txs []*Transaction
+	selected := make(map[string]bool)
+	skipped := make(map[string]bool)
+	size := 0
+
+	for {
+		var best []string
+		bestFee, bestSize := 0, 0
+
+		for txID, entry := range m.txs {
+			if selected[txID] || skipped[txID] {
+				continue
+			}
+
+			pkg := map[string]*mempoolEntry{txID: entry}
+			m.ancestors(txID, pkg)
+
+			var ids []string
+			pkgFee, pkgSize := 0, 0
+			for id, e := range pkg {
+				if !selected[id] {
+					ids = append(ids, id)
+					pkgFee += e.fee
+					pkgSize += e.size
+				}
+			}
+
+			if best == nil || pkgFee*bestSize > bestFee*pkgSize {
+				best, bestFee, bestSize = ids, pkgFee, pkgSize
+			}
+		}
+
+		if best == nil {
+			break
+		}
+		if size+bestSize > maxSize {
+			// the package doesn't fit, smaller ones still might.
+			for _, id := range best {
+				skipped[id] = true
+			}
+			continue
+		}
+
+		// a transaction has more ancestors than any of its ancestors.
+		depth := make(map[string]int)
+		for _, id := range best {
+			ancestors := make(map[string]*mempoolEntry)
+			m.ancestors(id, ancestors)
+			depth[id] = len(ancestors)
+		}
+		sort.Slice(best, func(i, j int) bool {
+			return depth[best[i]] < depth[best[j]]
+		})
+
+		for _, id := range best {
+			selected[id] = true
+			txs = append(txs, m.txs[id].tx)
+		}
+		size += bestSize
+	}
+
+	return txs
+}
+
+// Remove removes transactions, usually because they were mined, together
+// with the pooled transactions that spend the same outputs and everything
+// spending from those.
+func (m *Mempool) Remove(txs []*Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tx := range txs {
+		txID := hex.EncodeToString(tx.ID)
+		m.remove(txID)
+
+		for _, in := range tx.Vin {
+			if id, ok := m.spent[outpoint(in)]; ok {
+				conflicts := make(map[string]*mempoolEntry)
+				m.descendants(id, conflicts)
+				for conflictID := range conflicts {
+					m.remove(conflictID)
+				}
+			}
+		}
+	}
+}
+
+// remove drops a single entry from the pool and the indexes, the pooled
+// transactions spending from it no longer have it as an ancestor.
+func (m *Mempool) remove(txID string) {
+	entry := m.entry(txID)
+	if entry == nil {
+		return
+	}
+
+	delete(m.txs, txID)
+	delete(m.pending, txID)
+
+	for parentID := range entry.parents {
+		if parent := m.entry(parentID); parent != nil {
+			delete(parent.children, txID)
+		}
+	}
+	for childID := range entry.children {
+		if child := m.entry(childID); child != nil {
+			delete(child.parents, txID)
+		}
+	}
+
+	for _, in := range entry.tx.Vin {
+		if m.spent[outpoint(in)] == txID {
+			delete(m.spent, outpoint(in))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TransactionIsFinal(t *testing.T) {
+	tx := &Transaction{Vin: []TxInput{{Sequence: MaxTxInSequenceNum - 1}}}
+	assert.True(t, tx.IsFinal(1, 0), "no lock time")
+
+	tx.LockTime = 10
+	assert.False(t, tx.IsFinal(10, 0))
+	assert.True(t, tx.IsFinal(11, 0))
+
+	tx.LockTime = 1700000000
+	assert.False(t, tx.IsFinal(11, 1700000000))
+	assert.True(t, tx.IsFinal(11, 1700000001))
+
+	tx.Vin[0].Sequence = MaxTxInSequenceNum
+	assert.True(t, tx.IsFinal(11, 0), "final inputs disable the lock time")
+}
+
+func Test_MempoolHoldsLockedTransactions(t *testing.T) {
+	m := NewMempool()
+
+	locked := &Transaction{ID: []byte{1}, Vin: []TxInput{{}}, LockTime: 5}
+	_, err := m.Add(locked, 0, 3, 0)
+	assert.ErrorIs(t, err, ErrTxHeld)
+	assert.True(t, m.Has(locked.ID))
+	assert.Equal(t, 0, m.Count())
+
+	assert.Empty(t, m.Promote(5, 0))
+	assert.Equal(t, []*Transaction{locked}, m.Promote(6, 0))
+	assert.Equal(t, 1, m.Count())
+
+	m.Remove([]*Transaction{locked})
+	assert.False(t, m.Has(locked.ID))
+}
+
+func Test_MempoolReplaceByFee(t *testing.T) {
+	m := NewMempool()
+	in := TxInput{TxId: []byte{9}, Vout: 0, Sequence: MaxRBFSequence}
+
+	orig := &Transaction{ID: []byte{1}, Vin: []TxInput{in}}
+	_, err := m.Add(orig, 1, 1, 0)
+	assert.NoError(t, err)
+
+	cheaper := &Transaction{ID: []byte{2}, Vin: []TxInput{in}}
+	_, err = m.Add(cheaper, 1, 1, 0)
+	assert.ErrorIs(t, err, ErrInsufficientFee)
+
+	bumped := &Transaction{ID: []byte{3}, Vin: []TxInput{in}}
+	replaced, err := m.Add(bumped, 2, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Transaction{orig}, replaced)
+	assert.False(t, m.Has(orig.ID))
+	assert.True(t, m.Has(bumped.ID))
+
+	// one more unit doesn't pay for relaying a much larger replacement.
+	outs := make([]TxOutput, 200)
+	for i := range outs {
+		outs[i] = TxOutput{Value: 1, ScriptPubKey: NewP2PKHScript(make([]byte, 20))}
+	}
+	larger := &Transaction{ID: []byte{6}, Vin: []TxInput{in}, Vout: outs}
+	_, err = m.Add(larger, 3, 1, 0)
+	assert.ErrorIs(t, err, ErrInsufficientFee)
+	minFee := 2 + incrementalRelayFee*((len(larger.Serialize())+999)/1000)
+	_, err = m.Add(larger, minFee, 1, 0)
+	assert.ErrorIs(t, err, ErrInsufficientFee, "the fee rate can't drop")
+
+	final := TxInput{TxId: []byte{8}, Vout: 0, Sequence: MaxTxInSequenceNum}
+	_, err = m.Add(&Transaction{ID: []byte{4}, Vin: []TxInput{final}}, 1, 1, 0)
+	assert.NoError(t, err)
+	_, err = m.Add(&Transaction{ID: []byte{5}, Vin: []TxInput{final}}, 5, 1, 0)
+	assert.ErrorIs(t, err, ErrTxConflict, "transactions that don't signal can't be replaced")
+}
+
+func Test_MempoolChildPaysForParent(t *testing.T) {
+	m := NewMempool()
+
+	parent := &Transaction{ID: []byte{1}, Vin: []TxInput{{TxId: []byte{9}, Sequence: MaxRBFSequence}}}
+	child := &Transaction{ID: []byte{2}, Vin: []TxInput{{TxId: parent.ID}}}
+	other := &Transaction{ID: []byte{3}, Vin: []TxInput{{TxId: []byte{8}}}}
+
+	_, err := m.Add(child, 10, 1, 0)
+	assert.NoError(t, err, "an unknown parent is looked up in the chain")
+	m.Remove([]*Transaction{child})
+
+	for _, e := range []struct {
+		tx  *Transaction
+		fee int
+	}{{parent, 0}, {child, 10}, {other, 4}} {
+		_, err := m.Add(e.tx, e.fee, 1, 0)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]*Transaction{"01": parent}, m.Parents(child))
+
+	assert.Equal(t, []*Transaction{parent, child, other}, m.BlockTemplate(activeParams.MaxBlockSize),
+		"the child pulls its parent in before the other transaction")
+	assert.Equal(t, []*Transaction{other}, m.BlockTemplate(len(other.Serialize())))
+
+	replacement := &Transaction{ID: []byte{4}, Vin: parent.Vin}
+	_, err = m.Add(replacement, 10, 1, 0)
+	assert.ErrorIs(t, err, ErrInsufficientFee, "a replacement pays for the evicted descendants too")
+
+	replaced, err := m.Add(replacement, 11, 1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, replaced, 2)
+	assert.False(t, m.Has(child.ID))
+
+	m.Remove([]*Transaction{replacement})
+	assert.Equal(t, []*Transaction{other}, m.Transactions())
+}
+
+func Test_CheckTxSanity(t *testing.T) {
+	tx := &Transaction{Vin: []TxInput{{TxId: []byte{9}}}, Vout: []TxOutput{{Value: 10}}}
+	tx.ID = tx.Hash()
+	assert.NoError(t, checkTxSanity(tx))
+
+	tx.Vin[0].ScriptSig = []byte{1}
+	assert.NoError(t, checkTxSanity(tx), "signing keeps the id")
+	tx.ID = []byte{1}
+	assert.ErrorIs(t, checkTxSanity(tx), ErrBadTxID)
+
+	coinbase := NewCoinbaseTx(NewAccount().String(), "fixed", 7)
+	assert.NoError(t, checkTxSanity(coinbase))
+	coinbase.ID = NewCoinbaseTx(NewAccount().String(), "fixed", 6).ID
+	assert.ErrorIs(t, checkTxSanity(coinbase), ErrBadTxID, "a coinbase can't take another id")
+
+	tx.Vout[0].Value = activeParams.DustLimit - 1
+	tx.ID = tx.computeID()
+	assert.ErrorIs(t, checkTxSanity(tx), ErrDust)
+
+	tx.Vout = make([]TxOutput, activeParams.MaxTxOutputs+1)
+	for i := range tx.Vout {
+		tx.Vout[i].Value = activeParams.DustLimit
+	}
+	tx.ID = tx.computeID()
+	assert.ErrorIs(t, checkTxSanity(tx), ErrOversize)
+
+	tx.Vout = nil
+	tx.ID = tx.computeID()
+	assert.Error(t, checkTxSanity(tx))
+}
+
+func Test_CoinbaseMaturity(t *testing.T) {
+	outs := TxOutputs{Height: 5, Coinbase: true}
+	assert.False(t, outs.IsMature(5+activeParams.CoinbaseMaturity-1))
+	assert.True(t, outs.IsMature(5+activeParams.CoinbaseMaturity))
+
+	outs.Coinbase = false
+	assert.True(t, outs.IsMature(6))
+
+	genesis := TxOutputs{Height: 0, Coinbase: true}
+	assert.True(t, genesis.IsMature(1), "the genesis coinbase is always mature")
+}
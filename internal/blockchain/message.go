@@ -0,0 +1,69 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// signedMessagePrefix separates message signatures from transaction ones, a
+// signed message never hashes like a transaction.
+const signedMessagePrefix = "blockchain-go Signed Message:\n"
+
+var ErrInvalidSignature = errors.New("message signature is not valid")
+
+// messageHash returns the double SHA-256 of the prefixed message, every part
+// is preceded by its length.
+func messageHash(message string) []byte {
+	var buf bytes.Buffer
+	for _, part := range []string{signedMessagePrefix, message} {
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(part)))
+		buf.WriteString(part)
+	}
+
+	first := sha256.Sum256(buf.Bytes())
+	second := sha256.Sum256(first[:])
+
+	return second[:]
+}
+
+// SignMessage signs message with the account key. The Base64 signature
+// carries the public key so it can be checked against the address.
+func (a *Account) SignMessage(message string) (string, error) {
+	signature, err := signHash(&a.PrivateKey, messageHash(message))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(append(a.PublicKey, signature...)), nil
+}
+
+// VerifyMessage checks that signature was made by the key of address over
+// message.
+func VerifyMessage(address, signature, message string) error {
+	addr, err := ValidateAddress(address)
+	if err != nil {
+		return err
+	}
+	if addr.Kind != PubKeyHashAddress {
+		return fmt.Errorf("messages can only be signed by %s addresses", PubKeyHashAddress)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(data) <= signatureLen {
+		return fmt.Errorf("%w: malformed", ErrInvalidSignature)
+	}
+
+	pubKey, sig := data[:len(data)-signatureLen], data[len(data)-signatureLen:]
+	if !bytes.Equal(HashPubKey(pubKey), addr.Hash) {
+		return fmt.Errorf("%w: key does not belong to %s", ErrInvalidSignature, address)
+	}
+	if !verifySignature(pubKey, sig, messageHash(message)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ChainParams defines the parameters that differ between networks.
+type ChainParams struct {
+	// Name is the network name accepted by SelectParams.
+	Name string
+	// Net is the magic value that prefixes every message on the network.
+	Net uint32
+	// DefaultPort is the port of the seed node.
+	DefaultPort string
+
+	// PubKeyHashAddrID and ScriptHashAddrID are the address version bytes.
+	PubKeyHashAddrID byte
+	ScriptHashAddrID byte
+	// PrivateKeyID is the version byte of private keys in Wallet Import Format.
+	PrivateKeyID byte
+
+	// GenesisCoinbaseData is put into the coinbase of the genesis block.
+	GenesisCoinbaseData string
+
+	// PowLimitBits is the number of leading zero bits a block hash must have.
+	PowLimitBits int
+
+	// BaseSubsidy is the reward of the first block, which is halved every
+	// SubsidyHalvingInterval blocks.
+	BaseSubsidy            int
+	SubsidyHalvingInterval int
+
+	// MaxBlockSize and MaxTxSize bound the serialized size of blocks and
+	// transactions, MaxTxInputs and MaxTxOutputs the size of their lists.
+	MaxBlockSize int
+	MaxTxSize    int
+	MaxTxInputs  int
+	MaxTxOutputs int
+	// DustLimit is the smallest value an output may carry, coinbase
+	// outputs excepted.
+	DustLimit int
+	// CoinbaseMaturity is the number of blocks after its own a coinbase
+	// output can first be spent in.
+	CoinbaseMaturity int
+
+	// Checkpoints are blocks of the best chain, sorted by height, no fork
+	// below the last one is accepted. The networks have no public chain to
+	// checkpoint yet, nodes add their own with AddCheckpoint.
+	Checkpoints []Checkpoint
+	// AssumeValid is a block of the best chain whose ancestors are assumed
+	// to carry valid signatures, it is enforced like a checkpoint.
+	AssumeValid *Checkpoint
+}
+
+// Checkpoint is a block known to be in the best chain.
+type Checkpoint struct {
+	Height int
+	Hash   []byte
+}
+
+// ParseCheckpoint parses a checkpoint written as height:hash.
+func ParseCheckpoint(s string) (Checkpoint, error) {
+	heightStr, hashStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return Checkpoint{}, fmt.Errorf("checkpoint %q is not height:hash", s)
+	}
+
+	height, err := strconv.Atoi(heightStr)
+	if err != nil || height < 0 {
+		return Checkpoint{}, fmt.Errorf("checkpoint %q has an invalid height", s)
+	}
+	hash, err := hex.DecodeString(hashStr)
+	if err != nil || len(hash) != sha256.Size {
+		return Checkpoint{}, fmt.Errorf("checkpoint %q has an invalid hash", s)
+	}
+
+	return Checkpoint{Height: height, Hash: hash}, nil
+}
+
+// MainNetParams are the parameters of the main network.
+var MainNetParams = ChainParams{
+	Name:                   "main",
+	Net:                    0xd9b4bef9,
+	DefaultPort:            "3000",
+	PubKeyHashAddrID:       0x00,
+	ScriptHashAddrID:       0x05,
+	PrivateKeyID:           0x80,
+	GenesisCoinbaseData:    "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+	PowLimitBits:           16,
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 210000,
+	MaxBlockSize:           1000000,
+	MaxTxSize:              100000,
+	MaxTxInputs:            2000,
+	MaxTxOutputs:           2000,
+	DustLimit:              1,
+	CoinbaseMaturity:       100,
+}
+
+// TestNetParams are the parameters of the public test network.
+var TestNetParams = ChainParams{
+	Name:                   "test",
+	Net:                    0x0709110b,
+	DefaultPort:            "13000",
+	PubKeyHashAddrID:       0x6f,
+	ScriptHashAddrID:       0xc4,
+	PrivateKeyID:           0xef,
+	GenesisCoinbaseData:    "blockchain-go test network genesis block",
+	PowLimitBits:           12,
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 210000,
+	MaxBlockSize:           1000000,
+	MaxTxSize:              100000,
+	MaxTxInputs:            2000,
+	MaxTxOutputs:           2000,
+	DustLimit:              1,
+	CoinbaseMaturity:       100,
+}
+
+// RegTestParams are the parameters of the local regression test network.
+var RegTestParams = ChainParams{
+	Name:                   "regtest",
+	Net:                    0xdab5bffa,
+	DefaultPort:            "23000",
+	PubKeyHashAddrID:       0x6f,
+	ScriptHashAddrID:       0xc4,
+	PrivateKeyID:           0xef,
+	GenesisCoinbaseData:    "blockchain-go regression test genesis block",
+	PowLimitBits:           8,
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 150,
+	MaxBlockSize:           1000000,
+	MaxTxSize:              100000,
+	MaxTxInputs:            2000,
+	MaxTxOutputs:           2000,
+	DustLimit:              1,
+	CoinbaseMaturity:       100,
+}
+
+var registeredParams = []*ChainParams{&MainNetParams, &TestNetParams, &RegTestParams}
+
+var activeParams = &MainNetParams
+
+// SelectParams makes the network called name the active one.
+func SelectParams(name string) error {
+	for _, params := range registeredParams {
+		if params.Name == name {
+			activeParams = params
+			return nil
+		}
+	}
+
+	var names []string
+	for _, params := range registeredParams {
+		names = append(names, params.Name)
+	}
+
+	return fmt.Errorf("unknown network %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// ActiveParams returns the parameters of the active network.
+func ActiveParams() *ChainParams {
+	return activeParams
+}
+
+// AddCheckpoint adds a checkpoint to the active network, it replaces the one
+// at the same height.
+func AddCheckpoint(cp Checkpoint) {
+	checkpoints := slices.DeleteFunc(slices.Clone(activeParams.Checkpoints), func(c Checkpoint) bool {
+		return c.Height == cp.Height
+	})
+	checkpoints = append(checkpoints, cp)
+	slices.SortFunc(checkpoints, func(a, b Checkpoint) int {
+		return a.Height - b.Height
+	})
+
+	activeParams.Checkpoints = checkpoints
+}
+
+// SetAssumeValid sets the assume-valid block of the active network.
+func SetAssumeValid(cp Checkpoint) {
+	activeParams.AssumeValid = &cp
+}
+
+// checkpoint returns the checkpoint or assume-valid block at height.
+func (p *ChainParams) checkpoint(height int) (Checkpoint, bool) {
+	if p.AssumeValid != nil && p.AssumeValid.Height == height {
+		return *p.AssumeValid, true
+	}
+	for _, cp := range p.Checkpoints {
+		if cp.Height == height {
+			return cp, true
+		}
+	}
+
+	return Checkpoint{}, false
+}
+
+// lastCheckpoint returns the highest checkpoint or assume-valid block.
+func (p *ChainParams) lastCheckpoint() (Checkpoint, bool) {
+	var last Checkpoint
+	ok := false
+	if len(p.Checkpoints) > 0 {
+		last, ok = p.Checkpoints[len(p.Checkpoints)-1], true
+	}
+	if p.AssumeValid != nil && (!ok || p.AssumeValid.Height > last.Height) {
+		last, ok = *p.AssumeValid, true
+	}
+
+	return last, ok
+}
+
+// CalcBlockSubsidy returns the coinbase reward of a block at height.
+func (p *ChainParams) CalcBlockSubsidy(height int) int {
+	if p.SubsidyHalvingInterval <= 0 {
+		return p.BaseSubsidy
+	}
+
+	halvings := height / p.SubsidyHalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return p.BaseSubsidy >> uint(halvings)
+}
+
+// dataFile returns the path of a per-node file on this network, main network
+// files keep their historical names.
+func (p *ChainParams) dataFile(format, node string) string {
+	if p != &MainNetParams {
+		node = fmt.Sprintf("%s_%s", node, p.Name)
+	}
+
+	return fmt.Sprintf(format, node)
+}
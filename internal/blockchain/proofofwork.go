@@ -1,17 +1,12 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"math"
 	"math/big"
 )
 
-var maxNonce = math.MaxInt64
-
-const targetBits = 16
-
 // ProofOfWork represents a proof-of-work.
 type ProofOfWork struct {
 	block  *Block
@@ -21,7 +16,7 @@ type ProofOfWork struct {
 // NewProofOfWork builds and returns a ProofOfWork.
 func NewProofOfWork(block *Block) *ProofOfWork {
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
+	target.Lsh(target, uint(256-activeParams.PowLimitBits))
 
 	pow := &ProofOfWork{
 		block:  block,
@@ -31,54 +26,42 @@ func NewProofOfWork(block *Block) *ProofOfWork {
 	return pow
 }
 
-// Run performs a proof-of-work
-func (pow *ProofOfWork) Run() (int, []byte) {
+// Run performs a proof-of-work, when every nonce fails the timestamp of the
+// block is moved forward for new ones.
+func (pow *ProofOfWork) Run() (uint32, []byte) {
 	var hashInt big.Int
 	var hash [32]byte
-	nonce := 0
+	data := pow.block.BlockHeader.Serialize()
 
-	for nonce < maxNonce {
-		data := pow.prepareData(nonce)
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(data[nonceOffset:], nonce)
 
 		hash = sha256.Sum256(data)
 		hashInt.SetBytes(hash[:])
 
 		if hashInt.Cmp(pow.target) == -1 {
-			break
+			return nonce, hash[:]
 		}
 
-		nonce++
-	}
-
-	return nonce, hash[:]
-}
-
-// prepareData Prepare data wait for performs.
-func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	ithFn := func(num int64) []byte {
-		var buf bytes.Buffer
-		_ = binary.Write(&buf, binary.BigEndian, num)
-		return buf.Bytes()
+		if nonce == math.MaxUint32 {
+			pow.block.Timestamp++
+			data = pow.block.BlockHeader.Serialize()
+		}
 	}
-
-	data := bytes.Join([][]byte{
-		pow.block.PrevBlockHash,
-		pow.block.HashTransactions(),
-		ithFn(pow.block.Timestamp),
-		ithFn(int64(targetBits)),
-		ithFn(int64(nonce)),
-	}, []byte{})
-
-	return data
 }
 
 // Validate validates block's PoW.
 func (pow *ProofOfWork) Validate() bool {
+	return checkHeader(&pow.block.BlockHeader) == nil
+}
+
+// checkPoW checks that hash satisfies the proof of work target.
+func checkPoW(hash []byte) bool {
 	var hashInt big.Int
+	hashInt.SetBytes(hash)
 
-	data := pow.prepareData(pow.block.Nonce)
-	hash := sha256.Sum256(data)
-	hashInt.SetBytes(hash[:])
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-activeParams.PowLimitBits))
 
-	return hashInt.Cmp(pow.target) == -1
+	return hashInt.Cmp(target) == -1
 }
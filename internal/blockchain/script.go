@@ -0,0 +1,833 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Opcodes understood by the script interpreter. The values follow Bitcoin's
+// numbering so that scripts look familiar in a hex dump.
+const (
+	op0                   = 0x00
+	opPushData1           = 0x4c
+	opPushData2           = 0x4d
+	op1Negate             = 0x4f
+	op1                   = 0x51
+	op16                  = 0x60
+	opVerify              = 0x69
+	opReturn              = 0x6a
+	opDrop                = 0x75
+	opDup                 = 0x76
+	opEqual               = 0x87
+	opEqualVerify         = 0x88
+	opHash160             = 0xa9
+	opCheckSig            = 0xac
+	opCheckSigVerify      = 0xad
+	opCheckMultiSig       = 0xae
+	opCheckMultiSigVerify = 0xaf
+	opCheckLockTimeVerify = 0xb1
+)
+
+const (
+	// lockTimeThreshold separates block heights from unix timestamps in lock times.
+	lockTimeThreshold = 500000000
+	// maxMultiSigKeys is the largest n accepted by OP_CHECKMULTISIG.
+	maxMultiSigKeys = 16
+	// signatureLen is the length of a serialized r||s signature.
+	signatureLen = 64
+)
+
+var opNames = map[byte]string{
+	op0:                   "OP_0",
+	opPushData1:           "OP_PUSHDATA1",
+	opPushData2:           "OP_PUSHDATA2",
+	op1Negate:             "OP_1NEGATE",
+	opVerify:              "OP_VERIFY",
+	opReturn:              "OP_RETURN",
+	opDrop:                "OP_DROP",
+	opDup:                 "OP_DUP",
+	opEqual:               "OP_EQUAL",
+	opEqualVerify:         "OP_EQUALVERIFY",
+	opHash160:             "OP_HASH160",
+	opCheckSig:            "OP_CHECKSIG",
+	opCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	opCheckMultiSig:       "OP_CHECKMULTISIG",
+	opCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	opCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+var (
+	ErrScriptParse  = errors.New("malformed script")
+	ErrScriptFailed = errors.New("script evaluated to false")
+	ErrStackEmpty   = errors.New("stack is empty")
+	ErrUnknownOp    = errors.New("unknown opcode")
+	ErrLockTime     = errors.New("lock time requirement not satisfied")
+)
+
+// ScriptBuilder assembles a script from opcodes and data pushes.
+type ScriptBuilder struct {
+	script []byte
+}
+
+// NewScriptBuilder returns an empty ScriptBuilder.
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+// AddOp appends an opcode.
+func (b *ScriptBuilder) AddOp(op byte) *ScriptBuilder {
+	b.script = append(b.script, op)
+
+	return b
+}
+
+// AddData appends the smallest push operation for data.
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	switch l := len(data); {
+	case l < opPushData1:
+		b.script = append(b.script, byte(l))
+	case l <= 0xff:
+		b.script = append(b.script, opPushData1, byte(l))
+	default:
+		var buf [2]byte
+		binary.LittleEndian.PutUint16(buf[:], uint16(l))
+		b.script = append(b.script, opPushData2)
+		b.script = append(b.script, buf[:]...)
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+// AddInt64 appends a number, using the small integer opcodes when possible.
+func (b *ScriptBuilder) AddInt64(v int64) *ScriptBuilder {
+	switch {
+	case v == 0:
+		return b.AddOp(op0)
+	case v == -1:
+		return b.AddOp(op1Negate)
+	case v >= 1 && v <= 16:
+		return b.AddOp(byte(op1 - 1 + v))
+	}
+
+	return b.AddData(encodeScriptNum(v))
+}
+
+// Script returns the assembled script.
+func (b *ScriptBuilder) Script() []byte {
+	return b.script
+}
+
+// NewP2PKHScript returns a pay-to-pubkey-hash locking script.
+func NewP2PKHScript(pubKeyHash []byte) []byte {
+	return NewScriptBuilder().
+		AddOp(opDup).
+		AddOp(opHash160).
+		AddData(pubKeyHash).
+		AddOp(opEqualVerify).
+		AddOp(opCheckSig).
+		Script()
+}
+
+// NewP2SHScript returns a pay-to-script-hash locking script.
+func NewP2SHScript(scriptHash []byte) []byte {
+	return NewScriptBuilder().
+		AddOp(opHash160).
+		AddData(scriptHash).
+		AddOp(opEqual).
+		Script()
+}
+
+// NewMultiSigScript returns an m-of-n multisig locking script.
+func NewMultiSigScript(required int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > maxMultiSigKeys {
+		return nil, fmt.Errorf("multisig needs between 1 and %d public keys", maxMultiSigKeys)
+	}
+	if required < 1 || required > len(pubKeys) {
+		return nil, fmt.Errorf("required signatures must be between 1 and %d", len(pubKeys))
+	}
+
+	builder := NewScriptBuilder().AddInt64(int64(required))
+	for _, pubKey := range pubKeys {
+		if _, err := parsePubKey(pubKey); err != nil {
+			return nil, err
+		}
+		builder.AddData(pubKey)
+	}
+
+	return builder.AddInt64(int64(len(pubKeys))).AddOp(opCheckMultiSig).Script(), nil
+}
+
+// NewLockTimeScript returns a P2PKH script that can't be spent before lockTime,
+// which is a block height below 500000000 and a unix timestamp otherwise.
+func NewLockTimeScript(lockTime int64, pubKeyHash []byte) []byte {
+	return NewScriptBuilder().
+		AddInt64(lockTime).
+		AddOp(opCheckLockTimeVerify).
+		AddOp(opDrop).
+		AddOp(opDup).
+		AddOp(opHash160).
+		AddData(pubKeyHash).
+		AddOp(opEqualVerify).
+		AddOp(opCheckSig).
+		Script()
+}
+
+// scriptClass identifies the standard script templates.
+type scriptClass int
+
+const (
+	nonStandardTy scriptClass = iota
+	pubKeyHashTy
+	lockTimeTy
+	multiSigTy
+	scriptHashTy
+)
+
+func (c scriptClass) String() string {
+	switch c {
+	case pubKeyHashTy:
+		return "pubkeyhash"
+	case lockTimeTy:
+		return "locktime"
+	case multiSigTy:
+		return "multisig"
+	case scriptHashTy:
+		return "scripthash"
+	default:
+		return "nonstandard"
+	}
+}
+
+// scriptInfo describes a standard locking script.
+type scriptInfo struct {
+	Class      scriptClass
+	PubKeyHash []byte
+	ScriptHash []byte
+	PubKeys    [][]byte
+	Required   int
+	LockTime   int64
+}
+
+// pubKeyHashes returns the hashes of the public keys that can sign for the
+// script.
+func (info scriptInfo) pubKeyHashes() [][]byte {
+	switch info.Class {
+	case pubKeyHashTy, lockTimeTy:
+		return [][]byte{info.PubKeyHash}
+	case multiSigTy:
+		hashes := make([][]byte, 0, len(info.PubKeys))
+		for _, pubKey := range info.PubKeys {
+			hashes = append(hashes, HashPubKey(pubKey))
+		}
+		return hashes
+	}
+
+	return nil
+}
+
+// classifyScript matches a locking script against the standard templates.
+func classifyScript(script []byte) scriptInfo {
+	ops, err := parseScript(script)
+	if err != nil {
+		return scriptInfo{Class: nonStandardTy}
+	}
+
+	if isPubKeyHash(ops) {
+		return scriptInfo{Class: pubKeyHashTy, PubKeyHash: ops[2].data}
+	}
+
+	if isScriptHash(ops) {
+		return scriptInfo{Class: scriptHashTy, ScriptHash: ops[1].data}
+	}
+
+	if len(ops) == 8 && ops[1].op == opCheckLockTimeVerify && ops[2].op == opDrop && isPubKeyHash(ops[3:]) {
+		lockTime, err := ops[0].number()
+		if err == nil && lockTime >= 0 {
+			return scriptInfo{Class: lockTimeTy, PubKeyHash: ops[5].data, LockTime: lockTime}
+		}
+	}
+
+	if n := len(ops); n >= 4 && ops[n-1].op == opCheckMultiSig {
+		required, err1 := ops[0].number()
+		total, err2 := ops[n-2].number()
+		if err1 == nil && err2 == nil && int(total) == n-3 && required >= 1 && required <= total {
+			var pubKeys [][]byte
+			for _, o := range ops[1 : n-2] {
+				if !o.isPush() || len(o.data) == 0 {
+					return scriptInfo{Class: nonStandardTy}
+				}
+				pubKeys = append(pubKeys, o.data)
+			}
+
+			return scriptInfo{Class: multiSigTy, PubKeys: pubKeys, Required: int(required)}
+		}
+	}
+
+	return scriptInfo{Class: nonStandardTy}
+}
+
+func isPubKeyHash(ops []parsedOp) bool {
+	return len(ops) == 5 &&
+		ops[0].op == opDup &&
+		ops[1].op == opHash160 &&
+		ops[2].isPush() && len(ops[2].data) == 20 &&
+		ops[3].op == opEqualVerify &&
+		ops[4].op == opCheckSig
+}
+
+func isScriptHash(ops []parsedOp) bool {
+	return len(ops) == 3 &&
+		ops[0].op == opHash160 &&
+		ops[1].isPush() && len(ops[1].data) == 20 &&
+		ops[2].op == opEqual
+}
+
+// parsedOp is a single opcode with the data it pushes, if any.
+type parsedOp struct {
+	op   byte
+	data []byte
+}
+
+func (o parsedOp) isPush() bool {
+	return o.op <= opPushData2
+}
+
+// number decodes the op as a script number.
+func (o parsedOp) number() (int64, error) {
+	switch {
+	case o.op == op0:
+		return 0, nil
+	case o.op == op1Negate:
+		return -1, nil
+	case o.op >= op1 && o.op <= op16:
+		return int64(o.op - op1 + 1), nil
+	case o.isPush():
+		return decodeScriptNum(o.data, 5)
+	}
+
+	return 0, ErrScriptParse
+}
+
+// parseScript splits a script into opcodes and pushed data.
+func parseScript(script []byte) ([]parsedOp, error) {
+	var ops []parsedOp
+
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+
+		var size int
+		switch {
+		case op > op0 && op < opPushData1:
+			size = int(op)
+		case op == opPushData1:
+			if i+1 > len(script) {
+				return nil, ErrScriptParse
+			}
+			size = int(script[i])
+			i++
+		case op == opPushData2:
+			if i+2 > len(script) {
+				return nil, ErrScriptParse
+			}
+			size = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			ops = append(ops, parsedOp{op: op})
+			continue
+		}
+
+		if i+size > len(script) {
+			return nil, ErrScriptParse
+		}
+		ops = append(ops, parsedOp{op: op, data: script[i : i+size]})
+		i += size
+	}
+
+	return ops, nil
+}
+
+// isPushOnly reports whether a script only pushes data.
+func isPushOnly(ops []parsedOp) bool {
+	for _, o := range ops {
+		if !o.isPush() && (o.op < op1Negate || o.op > op16) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pushedData returns the data pushed by a push-only script.
+func pushedData(script []byte) ([][]byte, error) {
+	ops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	if !isPushOnly(ops) {
+		return nil, ErrScriptParse
+	}
+
+	var data [][]byte
+	for _, o := range ops {
+		data = append(data, o.data)
+	}
+
+	return data, nil
+}
+
+// DisasmScript returns a human-readable representation of a script.
+func DisasmScript(script []byte) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return fmt.Sprintf("[error] %x", script)
+	}
+
+	var parts []string
+	for _, o := range ops {
+		switch {
+		case o.op > op0 && o.op <= opPushData2:
+			parts = append(parts, fmt.Sprintf("%x", o.data))
+		case o.op >= op1 && o.op <= op16:
+			parts = append(parts, fmt.Sprintf("OP_%d", o.op-op1+1))
+		default:
+			name, ok := opNames[o.op]
+			if !ok {
+				name = fmt.Sprintf("OP_UNKNOWN_%x", o.op)
+			}
+			parts = append(parts, name)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// encodeScriptNum encodes v as a minimal little-endian sign-magnitude number.
+func encodeScriptNum(v int64) []byte {
+	if v == 0 {
+		return nil
+	}
+
+	negative := v < 0
+	if negative {
+		v = -v
+	}
+
+	var result []byte
+	for v > 0 {
+		result = append(result, byte(v&0xff))
+		v >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// decodeScriptNum decodes a script number of at most maxLen bytes.
+func decodeScriptNum(v []byte, maxLen int) (int64, error) {
+	if len(v) > maxLen {
+		return 0, fmt.Errorf("script number is longer than %d bytes", maxLen)
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range v {
+		result |= int64(b) << uint(8*i)
+	}
+
+	if v[len(v)-1]&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(v)-1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
+
+func castToBool(v []byte) bool {
+	for i, b := range v {
+		if b != 0 {
+			// negative zero is still false.
+			return !(i == len(v)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
+
+// ----------------------------------------------------------------------------
+
+// scriptEngine executes scripts for a single transaction input.
+type scriptEngine struct {
+	tx    *Transaction
+	index int
+	stack [][]byte
+}
+
+// verifyScript checks that scriptSig unlocks scriptPubKey for input index of tx.
+// For pay-to-script-hash outputs the redeem script, which is the last item
+// pushed by scriptSig, must also succeed against the remaining items.
+func verifyScript(scriptSig, scriptPubKey []byte, tx *Transaction, index int) error {
+	sigOps, err := parseScript(scriptSig)
+	if err != nil {
+		return err
+	}
+	if !isPushOnly(sigOps) {
+		return errors.New("unlocking script must only push data")
+	}
+
+	e := &scriptEngine{tx: tx, index: index}
+	if err := e.execute(scriptSig); err != nil {
+		return err
+	}
+	sigStack := append([][]byte{}, e.stack...)
+
+	if err := e.execute(scriptPubKey); err != nil {
+		return err
+	}
+	if err := e.checkResult(); err != nil {
+		return err
+	}
+
+	if classifyScript(scriptPubKey).Class != scriptHashTy {
+		return nil
+	}
+
+	e.stack = sigStack
+	redeemScript, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if err := e.execute(redeemScript); err != nil {
+		return err
+	}
+
+	return e.checkResult()
+}
+
+// checkResult checks that the script left a true value on top of the stack.
+func (e *scriptEngine) checkResult() error {
+	if len(e.stack) == 0 || !castToBool(e.stack[len(e.stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+func (e *scriptEngine) push(v []byte) {
+	e.stack = append(e.stack, v)
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, ErrStackEmpty
+	}
+	v := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+
+	return v, nil
+}
+
+func (e *scriptEngine) popInt() (int64, error) {
+	v, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeScriptNum(v, 4)
+}
+
+func (e *scriptEngine) pushBool(v bool) {
+	if v {
+		e.push([]byte{1})
+	} else {
+		e.push(nil)
+	}
+}
+
+// execute runs script against the current stack.
+func (e *scriptEngine) execute(script []byte) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range ops {
+		switch {
+		case o.isPush():
+			e.push(o.data)
+		case o.op == op1Negate || (o.op >= op1 && o.op <= op16):
+			n, _ := o.number()
+			e.push(encodeScriptNum(n))
+		case o.op == opVerify:
+			if err := e.verify(); err != nil {
+				return err
+			}
+		case o.op == opReturn:
+			return errors.New("script returned early")
+		case o.op == opDrop:
+			if _, err := e.pop(); err != nil {
+				return err
+			}
+		case o.op == opDup:
+			if len(e.stack) == 0 {
+				return ErrStackEmpty
+			}
+			e.push(e.stack[len(e.stack)-1])
+		case o.op == opEqual, o.op == opEqualVerify:
+			a, err := e.pop()
+			if err != nil {
+				return err
+			}
+			b, err := e.pop()
+			if err != nil {
+				return err
+			}
+			e.pushBool(bytes.Equal(a, b))
+			if o.op == opEqualVerify {
+				if err := e.verify(); err != nil {
+					return err
+				}
+			}
+		case o.op == opHash160:
+			v, err := e.pop()
+			if err != nil {
+				return err
+			}
+			e.push(HashPubKey(v))
+		case o.op == opCheckSig, o.op == opCheckSigVerify:
+			if err := e.checkSig(script); err != nil {
+				return err
+			}
+			if o.op == opCheckSigVerify {
+				if err := e.verify(); err != nil {
+					return err
+				}
+			}
+		case o.op == opCheckMultiSig, o.op == opCheckMultiSigVerify:
+			if err := e.checkMultiSig(script); err != nil {
+				return err
+			}
+			if o.op == opCheckMultiSigVerify {
+				if err := e.verify(); err != nil {
+					return err
+				}
+			}
+		case o.op == opCheckLockTimeVerify:
+			if err := e.checkLockTime(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: 0x%02x", ErrUnknownOp, o.op)
+		}
+	}
+
+	return nil
+}
+
+func (e *scriptEngine) verify() error {
+	v, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(v) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+func (e *scriptEngine) checkSig(script []byte) error {
+	pubKey, err := e.pop()
+	if err != nil {
+		return err
+	}
+	sig, err := e.pop()
+	if err != nil {
+		return err
+	}
+
+	hash := e.tx.sigHash(e.index, script)
+	e.pushBool(verifySignature(pubKey, sig, hash))
+
+	return nil
+}
+
+// checkMultiSig implements OP_CHECKMULTISIG, including the extra element it
+// consumes from the stack. Signatures must appear in public key order.
+func (e *scriptEngine) checkMultiSig(script []byte) error {
+	total, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if total < 0 || total > maxMultiSigKeys {
+		return fmt.Errorf("invalid public key count %d", total)
+	}
+
+	pubKeys := make([][]byte, total)
+	for i := range pubKeys {
+		if pubKeys[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	required, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if required < 0 || required > total {
+		return fmt.Errorf("invalid signature count %d", required)
+	}
+
+	sigs := make([][]byte, required)
+	for i := range sigs {
+		if sigs[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.pop(); err != nil {
+		return err
+	}
+
+	// keys and signatures were popped in reverse order.
+	hash := e.tx.sigHash(e.index, script)
+	k := len(pubKeys) - 1
+	s := len(sigs) - 1
+	for s >= 0 && k >= s {
+		if verifySignature(pubKeys[k], sigs[s], hash) {
+			s--
+		}
+		k--
+	}
+	e.pushBool(s < 0)
+
+	return nil
+}
+
+// checkLockTime implements OP_CHECKLOCKTIMEVERIFY against the transaction lock time.
+func (e *scriptEngine) checkLockTime() error {
+	if len(e.stack) == 0 {
+		return ErrStackEmpty
+	}
+
+	lockTime, err := decodeScriptNum(e.stack[len(e.stack)-1], 5)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return fmt.Errorf("%w: negative lock time", ErrLockTime)
+	}
+
+	// a final input would let the transaction ignore its lock time.
+	if e.tx.Vin[e.index].Sequence == MaxTxInSequenceNum {
+		return fmt.Errorf("%w: input sequence is final", ErrLockTime)
+	}
+
+	txLockTime := e.tx.LockTime
+	if (lockTime < lockTimeThreshold) != (txLockTime < lockTimeThreshold) {
+		return fmt.Errorf("%w: lock time type mismatch", ErrLockTime)
+	}
+	if txLockTime < lockTime {
+		return fmt.Errorf("%w: %d < %d", ErrLockTime, txLockTime, lockTime)
+	}
+
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// signHash signs hash and returns a fixed-size r||s signature.
+func signHash(privateKey *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, signatureLen)
+	r.FillBytes(signature[:signatureLen/2])
+	s.FillBytes(signature[signatureLen/2:])
+
+	return signature, nil
+}
+
+// verifySignature checks an r||s signature of hash against a serialized public key.
+func verifySignature(pubKey, signature, hash []byte) bool {
+	if len(signature) != signatureLen {
+		return false
+	}
+
+	rawPubKey, err := parsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:signatureLen/2])
+	s := new(big.Int).SetBytes(signature[signatureLen/2:])
+
+	return ecdsa.Verify(rawPubKey, hash, r, s)
+}
+
+// parsePubKey parses a public key serialized as X||Y. Old wallets dropped the
+// leading zero bytes of the coordinates, such a shorter key is split where
+// both halves make a point of the curve.
+func parsePubKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	keyLen := len(pubKey)
+	if keyLen == 0 || (keyLen%2 != 0 && keyLen > 64) {
+		return nil, errors.New("invalid public key length")
+	}
+
+	var splits []int
+	if keyLen%2 == 0 {
+		splits = append(splits, keyLen/2)
+	}
+	for i := max(1, keyLen-32); i <= min(keyLen-1, 32); i++ {
+		if i != keyLen/2 || keyLen%2 != 0 {
+			splits = append(splits, i)
+		}
+	}
+
+	curve := elliptic.P256()
+	for _, i := range splits {
+		x := new(big.Int).SetBytes(pubKey[:i])
+		y := new(big.Int).SetBytes(pubKey[i:])
+		if curve.IsOnCurve(x, y) {
+			return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+		}
+	}
+
+	return nil, errors.New("public key is not on the curve")
+}
+
+// pubKeyBytes serializes a public key as fixed-size X||Y.
+func pubKeyBytes(pub *ecdsa.PublicKey) []byte {
+	pubKey := make([]byte, 64)
+	pub.X.FillBytes(pubKey[:32])
+	pub.Y.FillBytes(pubKey[32:])
+
+	return pubKey
+}
+
+// legacyPubKeyBytes serializes a public key like old wallets did, without the
+// leading zero bytes of the coordinates.
+func legacyPubKeyBytes(pub *ecdsa.PublicKey) []byte {
+	return append(pub.X.Bytes(), pub.Y.Bytes()...)
+}
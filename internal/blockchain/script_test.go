@@ -0,0 +1,117 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// spendingTx returns a funding transaction locked with script and a
+// transaction spending its first output.
+func spendingTx(script []byte) (*Transaction, map[string]Transaction) {
+	prev := Transaction{Vout: []TxOutput{{Value: 10, ScriptPubKey: script}}}
+	prev.ID = prev.Hash()
+
+	tx := &Transaction{
+		Vin:  []TxInput{{TxId: prev.ID, Vout: 0}},
+		Vout: []TxOutput{{Value: 10, ScriptPubKey: NewP2PKHScript(make([]byte, 20))}},
+	}
+	tx.ID = tx.Hash()
+
+	return tx, map[string]Transaction{hex.EncodeToString(prev.ID): prev}
+}
+
+func Test_ScriptNum(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 127, 128, -128, 255, 256, 500000000, 4294967295} {
+		n, err := decodeScriptNum(encodeScriptNum(v), 5)
+		assert.NoError(t, err)
+		assert.Equal(t, v, n)
+	}
+}
+
+func Test_P2PKH(t *testing.T) {
+	account := NewAccount()
+	other := NewAccount()
+	tx, prevTxs := spendingTx(NewP2PKHScript(HashPubKey(account.PublicKey)))
+
+	assert.NoError(t, tx.Sign(other.PrivateKey, prevTxs))
+	ok, _ := tx.Verify(prevTxs)
+	assert.False(t, ok, "a foreign key must not unlock the output")
+
+	assert.NoError(t, tx.Sign(account.PrivateKey, prevTxs))
+	ok, err := tx.Verify(prevTxs)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	tx.Vout[0].Value = 9
+	ok, _ = tx.Verify(prevTxs)
+	assert.False(t, ok, "changing an output must invalidate the signature")
+}
+
+func Test_MultiSig(t *testing.T) {
+	keys := []*Account{NewAccount(), NewAccount(), NewAccount()}
+	script, err := NewMultiSigScript(2, [][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey})
+	assert.NoError(t, err)
+	assert.Equal(t, multiSigTy, classifyScript(script).Class)
+
+	tx, prevTxs := spendingTx(script)
+
+	assert.NoError(t, tx.Sign(keys[2].PrivateKey, prevTxs))
+	ok, _ := tx.Verify(prevTxs)
+	assert.False(t, ok, "one signature is not enough")
+
+	assert.NoError(t, tx.Sign(NewAccount().PrivateKey, prevTxs))
+	ok, _ = tx.Verify(prevTxs)
+	assert.False(t, ok, "a key outside the set does not count")
+
+	assert.NoError(t, tx.Sign(keys[0].PrivateKey, prevTxs))
+	ok, err = tx.Verify(prevTxs)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func Test_CheckLockTimeVerify(t *testing.T) {
+	account := NewAccount()
+	script := NewLockTimeScript(100, HashPubKey(account.PublicKey))
+	assert.Equal(t, lockTimeTy, classifyScript(script).Class)
+
+	tx, prevTxs := spendingTx(script)
+	tx.LockTime = 99
+	assert.NoError(t, tx.Sign(account.PrivateKey, prevTxs))
+	ok, _ := tx.Verify(prevTxs)
+	assert.False(t, ok, "lock time is not reached")
+
+	tx.LockTime = 100
+	assert.NoError(t, tx.Sign(account.PrivateKey, prevTxs))
+	ok, err := tx.Verify(prevTxs)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func Test_P2SHMultiSig(t *testing.T) {
+	keys := []*Account{NewAccount(), NewAccount(), NewAccount()}
+	redeemScript, err := NewMultiSigScript(2, [][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey})
+	assert.NoError(t, err)
+
+	addr, err := ValidateAddress(NewScriptHashAddress(redeemScript))
+	assert.NoError(t, err)
+	assert.Equal(t, ScriptHashAddress, addr.Kind)
+
+	tx, prevTxs := spendingTx(addr.Script())
+	tx.SetRedeemScript(0, redeemScript)
+
+	assert.NoError(t, tx.Sign(keys[1].PrivateKey, prevTxs))
+	ok, _ := tx.Verify(prevTxs)
+	assert.False(t, ok, "one signature is not enough")
+
+	assert.NoError(t, tx.Sign(keys[2].PrivateKey, prevTxs))
+	ok, err = tx.Verify(prevTxs)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	other, _ := NewMultiSigScript(1, [][]byte{keys[0].PublicKey})
+	tx.SetRedeemScript(0, other)
+	ok, _ = tx.Verify(prevTxs)
+	assert.False(t, ok, "a different redeem script must not match the hash")
+}
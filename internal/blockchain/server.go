@@ -2,29 +2,48 @@ package blockchain
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sphierex/blockchain-go/pkg/bloom"
 )
 
 const (
+	magicLength = 4
 	cmdLength   = 12
 	nodeVersion = 1
+	// messageOverhead is the room left for the encoding around the largest
+	// payload of a message.
+	messageOverhead = 1 << 16
 )
 
 const (
-	VersionCmd   = "version"
-	AddrCmd      = "addr"
-	BlockCmd     = "block"
-	GetDataCmd   = "get_data"
-	InvCmd       = "inv"
-	GetBlocksCmd = "get_blocks"
-	TxCmd        = "tx"
+	VersionCmd    = "version"
+	AddrCmd       = "addr"
+	BlockCmd      = "block"
+	GetDataCmd    = "get_data"
+	InvCmd        = "inv"
+	GetBlocksCmd  = "get_blocks"
+	TxCmd         = "tx"
+	GetTxProofCmd = "get_tx_proof"
+	TxProofCmd    = "tx_proof"
+	GetHeadersCmd = "get_headers"
+	HeadersCmd    = "headers"
+	FilterLoadCmd = "filter_load"
 )
 
+var errNoValidTxs = errors.New("no valid transaction to mine")
+
 type Server struct {
 	Id           string
 	MinerAddress string
@@ -35,30 +54,52 @@ type Server struct {
 	bc             *Blockchain
 	us             *UTXOSet
 	blockInTransit [][]byte
-	mempool        map[string]Transaction
+	mempool        *Mempool
+
+	// filters are the bloom filters loaded by light clients, by endpoint.
+	// Only endpoints in handshakes, which sent a version from their own host,
+	// can load one.
+	filtersMu  sync.Mutex
+	filters    map[string]*bloom.Filter
+	handshakes map[string]bool
 }
 
 func NewServer(id, miner string) *Server {
 	bc, _ := NewBlockchain(id)
+	if err := bc.openHeaders(id); err != nil {
+		log.Println(err)
+	}
 
 	return &Server{
 		Id:             id,
 		MinerAddress:   miner,
 		bc:             bc,
-		endpoints:      []string{"localhost:3000"},
+		us:             NewUTXOSet(bc),
+		endpoints:      []string{fmt.Sprintf("localhost:%s", activeParams.DefaultPort)},
 		endpoint:       fmt.Sprintf("localhost:%s", id),
 		blockInTransit: make([][]byte, 0),
+		mempool:        NewMempool(),
+		filters:        make(map[string]*bloom.Filter),
+		handshakes:     make(map[string]bool),
 	}
 }
 
 func NewServerWithBlockchain(bc *Blockchain, id, miner string) *Server {
+	if err := bc.openHeaders(id); err != nil {
+		log.Println(err)
+	}
+
 	return &Server{
 		Id:             id,
 		MinerAddress:   miner,
 		bc:             bc,
-		endpoints:      []string{"localhost:3000"},
+		us:             NewUTXOSet(bc),
+		endpoints:      []string{fmt.Sprintf("localhost:%s", activeParams.DefaultPort)},
 		endpoint:       fmt.Sprintf("localhost:%s", id),
 		blockInTransit: make([][]byte, 0),
+		mempool:        NewMempool(),
+		filters:        make(map[string]*bloom.Filter),
+		handshakes:     make(map[string]bool),
 	}
 }
 
@@ -87,12 +128,12 @@ func (n *Server) Start() error {
 }
 
 func (n *Server) handleConn(conn net.Conn) {
-	req, err := io.ReadAll(conn)
+	cmd, req, err := readMessage(conn)
 	if err != nil {
+		log.Println(err)
+		_ = conn.Close()
 		return
 	}
-
-	cmd := bytesToCmd(req[:cmdLength])
 	log.Printf("Receive %s cmd\n", cmd)
 
 	switch cmd {
@@ -108,8 +149,18 @@ func (n *Server) handleConn(conn net.Conn) {
 		n.handleGetData(req)
 	case TxCmd:
 		n.handleTx(req)
+	case GetTxProofCmd:
+		n.handleGetTxProof(req)
+	case TxProofCmd:
+		n.handleTxProof(req)
+	case GetHeadersCmd:
+		n.handleGetHeaders(req)
+	case HeadersCmd:
+		n.handleHeaders(req)
+	case FilterLoadCmd:
+		n.handleFilterLoad(req, conn.RemoteAddr())
 	case VersionCmd:
-		n.handleVersion(req)
+		n.handleVersion(req, conn.RemoteAddr())
 	default:
 		log.Printf("unknown cmd: '%s'\r\n", cmd)
 	}
@@ -117,6 +168,32 @@ func (n *Server) handleConn(conn net.Conn) {
 	_ = conn.Close()
 }
 
+// isPeerHost checks whether the endpoint addr a peer claims is on the host
+// the message came from.
+func isPeerHost(addr string, remote net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || remote == nil {
+		return false
+	}
+	remoteHost, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return false
+	}
+
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return false
+	}
+	remoteIP := net.ParseIP(remoteHost)
+	for _, ip := range ips {
+		if net.ParseIP(ip).Equal(remoteIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (n *Server) hasEndpoint(addr string) bool {
 	for _, endpoint := range n.endpoints {
 		if endpoint == addr {
@@ -133,6 +210,8 @@ type versionReq struct {
 	Version    int
 	BestHeight int
 	FromAddr   string
+	// Timestamp is the clock of the sender, peers adjust their time with it.
+	Timestamp int64
 }
 
 type getBlocksReq struct {
@@ -165,6 +244,32 @@ type txReq struct {
 	Tx       []byte
 }
 
+type getTxProofReq struct {
+	FromAddr string
+	TxID     []byte
+}
+
+type txProofReq struct {
+	FromAddr string
+	Proof    *TxProof
+}
+
+type getHeadersReq struct {
+	FromAddr string
+	Locator  [][]byte
+}
+
+type filterLoadReq struct {
+	FromAddr string
+	Filter   bloom.Filter
+}
+
+type headersReq struct {
+	FromAddr    string
+	StartHeight int
+	Headers     []BlockHeader
+}
+
 func (n *Server) sendGetBlocks(addr string) {
 	payload := encode(getBlocksReq{FromAddr: n.endpoint})
 	req := append(cmdToBytes(GetBlocksCmd), payload...)
@@ -172,12 +277,25 @@ func (n *Server) sendGetBlocks(addr string) {
 	n.send(addr, req)
 }
 
+// sendGetHeaders asks addr for the headers following the header chain.
+func (n *Server) sendGetHeaders(addr string) {
+	n.bc.headersMu.Lock()
+	locator := n.bc.headers.Locator()
+	n.bc.headersMu.Unlock()
+
+	payload := encode(getHeadersReq{FromAddr: n.endpoint, Locator: locator})
+	req := append(cmdToBytes(GetHeadersCmd), payload...)
+
+	n.send(addr, req)
+}
+
 func (n *Server) sendVersion(addr string) {
 	bestHeight := n.bc.GetBestHeight()
 	payload := encode(versionReq{
 		Version:    nodeVersion,
 		BestHeight: bestHeight,
 		FromAddr:   n.endpoint,
+		Timestamp:  time.Now().Unix(),
 	})
 	req := append(cmdToBytes(VersionCmd), payload...)
 
@@ -238,6 +356,37 @@ func (n *Server) sendTx(addr string, tx *Transaction) {
 	n.send(addr, req)
 }
 
+func (n *Server) sendGetTxProof(addr string, txID []byte) {
+	payload := encode(getTxProofReq{
+		FromAddr: n.endpoint,
+		TxID:     txID,
+	})
+	req := append(cmdToBytes(GetTxProofCmd), payload...)
+
+	n.send(addr, req)
+}
+
+func (n *Server) sendTxProof(addr string, proof *TxProof) {
+	payload := encode(txProofReq{
+		FromAddr: n.endpoint,
+		Proof:    proof,
+	})
+	req := append(cmdToBytes(TxProofCmd), payload...)
+
+	n.send(addr, req)
+}
+
+func (n *Server) sendHeaders(addr string, start int, headers []BlockHeader) {
+	payload := encode(headersReq{
+		FromAddr:    n.endpoint,
+		StartHeight: start,
+		Headers:     headers,
+	})
+	req := append(cmdToBytes(HeadersCmd), payload...)
+
+	n.send(addr, req)
+}
+
 func (n *Server) SendTx(tx *Transaction) {
 	n.sendTx(n.endpoints[0], tx)
 }
@@ -249,8 +398,7 @@ func (n *Server) fetchBlocks() {
 }
 
 func (n *Server) send(endpoint string, v []byte) {
-	conn, err := net.Dial("tcp", endpoint)
-	if err != nil {
+	if err := sendMessage(endpoint, v); err != nil {
 		log.Printf("%s is not available\n", endpoint)
 		var nEndpoints []string
 		for _, node := range n.endpoints {
@@ -259,17 +407,12 @@ func (n *Server) send(endpoint string, v []byte) {
 			}
 		}
 		n.endpoints = nEndpoints
-
-		return
 	}
-	defer conn.Close()
-
-	_, _ = io.Copy(conn, bytes.NewReader(v))
 }
 
 // ----------------------------------------------------------------------------
 
-func (n *Server) handleVersion(v []byte) {
+func (n *Server) handleVersion(v []byte, remote net.Addr) {
 	var buf bytes.Buffer
 	var payload versionReq
 
@@ -280,9 +423,20 @@ func (n *Server) handleVersion(v []byte) {
 		return
 	}
 
+	n.bc.timeSource.AddSample(payload.FromAddr, payload.Timestamp)
+	if isPeerHost(payload.FromAddr, remote) {
+		n.filtersMu.Lock()
+		n.handshakes[payload.FromAddr] = true
+		n.filtersMu.Unlock()
+	}
+
 	innerBestHeight := n.bc.GetBestHeight()
 	foreignerBestHeight := payload.BestHeight
 
+	if n.bc.headers != nil && n.bc.headersHeight() < foreignerBestHeight {
+		// the headers tell which blocks the assume-valid one builds on.
+		n.sendGetHeaders(payload.FromAddr)
+	}
 	if innerBestHeight < foreignerBestHeight {
 		n.sendGetBlocks(payload.FromAddr)
 	}
@@ -320,19 +474,39 @@ func (n *Server) handleBlock(v []byte) {
 	_ = gob.NewDecoder(&buf).Decode(&payload)
 
 	blockData := payload.Block
+	if len(blockData) > activeParams.MaxBlockSize {
+		log.Printf("Reject block from %s: %d bytes\n", payload.FromAddr, len(blockData))
+		return
+	}
 	block := DeserializeBlock(blockData)
 
 	log.Printf("Receive a new block")
-	_ = n.bc.Submit(block)
+	oldTip := n.bc.latestHash()
+	if err := n.bc.Submit(block); err != nil {
+		log.Printf("Reject block %x: %v\n", block.Hash, err)
+		if errors.Is(err, ErrOrphan) {
+			// we are more than a block behind the peer.
+			n.sendGetBlocks(payload.FromAddr)
+		}
+		return
+	}
 	log.Printf("Added block %x\n", block.Hash)
+	// side branch blocks aren't notified until a reorg connects them.
+	connected, err := n.bc.connectedSince(oldTip)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, b := range connected {
+		n.notifyFilters(b)
+	}
+
+	n.mempool.Remove(block.Transactions)
+	n.promoteTxs()
 
 	if len(n.blockInTransit) > 0 {
 		blockHash := n.blockInTransit[0]
 		n.sendGetData(payload.FromAddr, "block", blockHash)
 		n.blockInTransit = n.blockInTransit[1:]
-	} else {
-		UtxoSet := NewUTXOSet(n.bc)
-		_ = UtxoSet.Rebuild()
 	}
 }
 
@@ -352,8 +526,10 @@ func (n *Server) handleInv(v []byte) {
 	switch payload.Kind {
 	case "block":
 		{
-			n.blockInTransit = payload.Values
-			blockHash := payload.Values[0]
+			// the hashes go from the tip down, parents are fetched first.
+			n.blockInTransit = slices.Clone(payload.Values)
+			slices.Reverse(n.blockInTransit)
+			blockHash := n.blockInTransit[0]
 
 			n.sendGetData(payload.FromAddr, "block", blockHash)
 
@@ -369,7 +545,7 @@ func (n *Server) handleInv(v []byte) {
 	case "tx":
 		{
 			txID := payload.Values[0]
-			if n.mempool[hex.EncodeToString(txID)].ID == nil {
+			if !n.mempool.Has(txID) {
 				n.sendGetData(payload.FromAddr, "tx", txID)
 			}
 		}
@@ -416,15 +592,212 @@ func (n *Server) handleGetData(v []byte) {
 		}
 	case "tx":
 		{
-			txID := hex.EncodeToString(payload.ID)
-			tx := n.mempool[txID]
+			tx, ok := n.mempool.Get(payload.ID)
+			if !ok {
+				log.Printf("tx id: %x is not in the mempool", payload.ID)
+				return
+			}
 
-			n.sendTx(payload.FromAddr, &tx)
+			n.sendTx(payload.FromAddr, tx)
 		}
 	default:
 	}
 }
 
+func (n *Server) handleGetTxProof(v []byte) {
+	var buf bytes.Buffer
+	var payload getTxProofReq
+
+	buf.Write(v[cmdLength:])
+	err := gob.NewDecoder(&buf).Decode(&payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	proof, err := n.bc.GetTxProof(payload.TxID)
+	if err != nil {
+		log.Printf("tx id: %x, err: %v", payload.TxID, err)
+		return
+	}
+
+	n.sendTxProof(payload.FromAddr, proof)
+}
+
+func (n *Server) handleGetHeaders(v []byte) {
+	var buf bytes.Buffer
+	var payload getHeadersReq
+
+	buf.Write(v[cmdLength:])
+	err := gob.NewDecoder(&buf).Decode(&payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	start, headers, err := n.bc.Headers(payload.Locator, maxHeadersPerMsg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	n.sendHeaders(payload.FromAddr, start, headers)
+}
+
+func (n *Server) handleHeaders(v []byte) {
+	var buf bytes.Buffer
+	var payload headersReq
+
+	buf.Write(v[cmdLength:])
+	err := gob.NewDecoder(&buf).Decode(&payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if n.bc.headers == nil {
+		return
+	}
+
+	n.bc.headersMu.Lock()
+	added, err := n.bc.headers.Connect(payload.StartHeight, payload.Headers)
+	n.bc.headersMu.Unlock()
+	if err != nil {
+		log.Printf("Reject headers from %s: %v\n", payload.FromAddr, err)
+		return
+	}
+	if added > 0 {
+		log.Printf("Synced %d headers, best height is %d\n", added, n.bc.headersHeight())
+	}
+
+	if len(payload.Headers) >= maxHeadersPerMsg {
+		n.sendGetHeaders(payload.FromAddr)
+	}
+}
+
+func (n *Server) handleFilterLoad(v []byte, remote net.Addr) {
+	var buf bytes.Buffer
+	var payload filterLoadReq
+
+	buf.Write(v[cmdLength:])
+	err := gob.NewDecoder(&buf).Decode(&payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !payload.Filter.IsValid() {
+		log.Printf("Reject filter of %s: too large\n", payload.FromAddr)
+		return
+	}
+
+	// a peer can't load a filter for another node, which would hide the
+	// transactions from it.
+	n.filtersMu.Lock()
+	if !n.handshakes[payload.FromAddr] || !isPeerHost(payload.FromAddr, remote) {
+		n.filtersMu.Unlock()
+		log.Printf("Reject filter of %s: no version from that peer\n", payload.FromAddr)
+		return
+	}
+	n.filters[payload.FromAddr] = &payload.Filter
+	n.filtersMu.Unlock()
+
+	if !n.hasEndpoint(payload.FromAddr) {
+		n.endpoints = append(n.endpoints, payload.FromAddr)
+	}
+
+	// catch the peer up with the matching transactions already mined.
+	var blocks []*Block
+	err = n.bc.Foreach(func(block *Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Height < blocks[j].Height
+	})
+
+	for _, block := range blocks {
+		n.sendMatchingProofs(payload.FromAddr, block)
+	}
+}
+
+// sendMatchingProofs sends addr the proofs of the transactions of block that
+// match its filter.
+func (n *Server) sendMatchingProofs(addr string, block *Block) {
+	n.filtersMu.Lock()
+	f := n.filters[addr]
+	var matched []int
+	for i, tx := range block.Transactions {
+		if f != nil && matchTx(f, tx) {
+			matched = append(matched, i)
+		}
+	}
+	n.filtersMu.Unlock()
+
+	for _, i := range matched {
+		proof, err := block.TxProof(i)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		n.sendTxProof(addr, proof)
+	}
+}
+
+// notifyFilters sends every peer with a filter the matching transactions of
+// a block connected to the best chain.
+func (n *Server) notifyFilters(block *Block) {
+	n.filtersMu.Lock()
+	var peers []string
+	for addr := range n.filters {
+		peers = append(peers, addr)
+	}
+	n.filtersMu.Unlock()
+
+	for _, addr := range peers {
+		n.sendMatchingProofs(addr, block)
+	}
+}
+
+// filterAllows checks whether tx may be announced to addr, peers with a filter
+// only hear about matching transactions.
+func (n *Server) filterAllows(addr string, tx *Transaction) bool {
+	n.filtersMu.Lock()
+	defer n.filtersMu.Unlock()
+
+	f, ok := n.filters[addr]
+
+	return !ok || matchTx(f, tx)
+}
+
+func (n *Server) handleTxProof(v []byte) {
+	var buf bytes.Buffer
+	var payload txProofReq
+
+	buf.Write(v[cmdLength:])
+	err := gob.NewDecoder(&buf).Decode(&payload)
+	if err != nil || payload.Proof == nil || payload.Proof.Tx == nil {
+		log.Println("drop malformed tx proof")
+		return
+	}
+	proof := payload.Proof
+
+	// the proof only counts against a block we know, not the root it carries.
+	block, err := n.bc.getBlockByKey(proof.BlockHash)
+	if err != nil {
+		log.Printf("Proof of %x is for unknown block %x\n", proof.Tx.ID, proof.BlockHash)
+		return
+	}
+
+	if !proof.Verify(block.MerkleRoot) {
+		log.Printf("Reject proof of %x in block %x\n", proof.Tx.ID, proof.BlockHash)
+		return
+	}
+	log.Printf("Transaction %x is in block %x\n", proof.Tx.ID, proof.BlockHash)
+}
+
 func (n *Server) handleTx(v []byte) {
 	var buf bytes.Buffer
 	var payload txReq
@@ -436,51 +809,42 @@ func (n *Server) handleTx(v []byte) {
 		return
 	}
 	txData := payload.Tx
+	if len(txData) > activeParams.MaxTxSize {
+		log.Printf("Reject transaction from %s: %d bytes\n", payload.FromAddr, len(txData))
+		return
+	}
 	tx := DeserializeTx(txData)
 
+	if err := n.acceptTx(&tx); err != nil {
+		if errors.Is(err, ErrTxHeld) {
+			log.Printf("Transaction %x is not final yet, holding it\n", tx.ID)
+		} else {
+			log.Printf("Reject transaction %x: %v\n", tx.ID, err)
+		}
+		return
+	}
+
 	fmt.Println(n.endpoints)
 
 	if n.endpoint == n.endpoints[0] {
-		for _, endpoint := range n.endpoints {
-			if endpoint != n.endpoint && endpoint != payload.FromAddr {
-				n.sendInv(endpoint, "tx", [][]byte{tx.ID})
-			}
-		}
+		n.broadcastTx(&tx, payload.FromAddr)
 	} else {
-		if len(n.mempool) >= 2 && len(n.MinerAddress) > 0 {
+		if n.mempool.Count() >= 2 && len(n.MinerAddress) > 0 {
 		mineTx:
-			var txs []*Transaction
-
-			for id := range n.mempool {
-				tx := n.mempool[id]
-				if n.bc.VerifyTx(&tx) {
-					txs = append(txs, &tx)
-				}
-			}
-
-			if len(txs) == 0 {
+			nBlock, err := n.mineBlock()
+			if errors.Is(err, errNoValidTxs) {
 				log.Println("All transactions are invalid, Waiting for new ones....")
 				return
 			}
-
-			cTx := NewCoinbaseTx(n.MinerAddress, "")
-			txs = append(txs, cTx)
-
-			nBlock, _ := n.bc.Mine(txs)
 			if err != nil {
 				log.Println(err)
 				return
 			}
 
-			UtxoSet := NewUTXOSet(n.bc)
-			_ = UtxoSet.Rebuild()
-
 			log.Println("New block is mined")
+			n.notifyFilters(nBlock)
 
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(n.mempool, txID)
-			}
+			n.mempool.Remove(nBlock.Transactions)
 
 			for _, endpoint := range n.endpoints {
 				if endpoint != n.endpoint {
@@ -488,15 +852,137 @@ func (n *Server) handleTx(v []byte) {
 				}
 			}
 
-			if len(n.mempool) > 0 {
+			n.promoteTxs()
+
+			if n.mempool.Count() > 0 {
 				goto mineTx
 			}
 		}
 	}
 }
 
+// mineBlock mines the pooled transactions that are still valid into a block
+// whose coinbase pays the miner.
+func (n *Server) mineBlock() (*Block, error) {
+	// the coinbase must come first in the block.
+	txs := []*Transaction{NewCoinbaseTx(n.MinerAddress, "", n.bc.GetBestHeight()+1)}
+
+	// the template puts parents first, a transaction can only be mined
+	// along with the pooled parents that are still valid.
+	parents := make(map[string]*Transaction)
+	for _, tx := range n.mempool.BlockTemplate(activeParams.MaxBlockSize - blockReservedSize) {
+		if n.bc.VerifyTxWithParents(tx, parents) {
+			txs = append(txs, tx)
+			parents[hex.EncodeToString(tx.ID)] = tx
+		}
+	}
+	if len(txs) == 1 {
+		return nil, errNoValidTxs
+	}
+
+	return n.bc.Mine(txs)
+}
+
+// acceptTx verifies a transaction, which may spend outputs of pooled ones, and
+// adds it to the mempool, replacing the transactions it conflicts with when it
+// pays a higher fee.
+func (n *Server) acceptTx(tx *Transaction) error {
+	if err := checkTxSanity(tx); err != nil {
+		return err
+	}
+
+	parents := n.mempool.Parents(tx)
+	if !n.bc.VerifyTxWithParents(tx, parents) {
+		return errors.New("invalid transaction")
+	}
+	if err := n.bc.checkCoinbaseSpends([]*Transaction{tx}, n.bc.latestHash(), n.bc.GetBestHeight()+1); err != nil {
+		return err
+	}
+
+	fee, err := n.us.FeeWithParents(tx, parents)
+	if err != nil {
+		return err
+	}
+
+	medianTimePast, err := n.bc.medianTimePast(n.bc.latestHash())
+	if err != nil {
+		return err
+	}
+
+	replaced, err := n.mempool.Add(tx, fee, n.bc.GetBestHeight()+1, medianTimePast)
+	for _, r := range replaced {
+		log.Printf("Transaction %x is replaced by %x\n", r.ID, tx.ID)
+	}
+
+	return err
+}
+
+// broadcastTx announces a transaction to every known node except the sender.
+func (n *Server) broadcastTx(tx *Transaction, from string) {
+	for _, endpoint := range n.endpoints {
+		if endpoint != n.endpoint && endpoint != from && n.filterAllows(endpoint, tx) {
+			n.sendInv(endpoint, "tx", [][]byte{tx.ID})
+		}
+	}
+}
+
+// promoteTxs releases the held transactions that became final and announces them.
+func (n *Server) promoteTxs() {
+	medianTimePast, err := n.bc.medianTimePast(n.bc.latestHash())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	promoted := n.mempool.Promote(n.bc.GetBestHeight()+1, medianTimePast)
+	for _, tx := range promoted {
+		log.Printf("Transaction %x is final now\n", tx.ID)
+		n.broadcastTx(tx, "")
+	}
+}
+
 // ----------------------------------------------------------------------------
 
+// maxMessageSize returns the size of the largest message a peer may send, a
+// full block with room for the message encoding.
+func maxMessageSize() int64 {
+	return int64(magicLength + cmdLength + activeParams.MaxBlockSize + messageOverhead)
+}
+
+// readMessage reads a message of the active network from conn and returns its
+// command and the message without the network magic.
+func readMessage(conn net.Conn) (string, []byte, error) {
+	req, err := io.ReadAll(io.LimitReader(conn, maxMessageSize()+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(req)) > maxMessageSize() {
+		return "", nil, fmt.Errorf("%w: message is larger than %d bytes", ErrOversize, maxMessageSize())
+	}
+
+	if len(req) < magicLength+cmdLength || binary.LittleEndian.Uint32(req) != activeParams.Net {
+		return "", nil, errors.New("drop message from another network")
+	}
+	req = req[magicLength:]
+
+	return bytesToCmd(req[:cmdLength]), req, nil
+}
+
+// sendMessage sends a message prefixed with the network magic to endpoint.
+func sendMessage(endpoint string, v []byte) error {
+	conn, err := net.Dial("tcp", endpoint)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var magic [magicLength]byte
+	binary.LittleEndian.PutUint32(magic[:], activeParams.Net)
+	_, err = io.Copy(conn, io.MultiReader(bytes.NewReader(magic[:]), bytes.NewReader(v)))
+
+	return err
+}
+
 func encode(v interface{}) []byte {
 	var buf bytes.Buffer
 	_ = gob.NewEncoder(&buf).Encode(v)
@@ -0,0 +1,213 @@
+package blockchain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+)
+
+// newTestChain creates a regtest blockchain in a temporary directory whose
+// genesis coinbase pays owner.
+func newTestChain(t *testing.T, owner *Account) *Blockchain {
+	t.Helper()
+
+	assert.NoError(t, SelectParams(RegTestParams.Name))
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	assert.NoError(t, os.MkdirAll("zblock/dbs", 0700))
+
+	bc, err := CreateBlockchain("test", owner.String())
+	assert.NoError(t, err)
+	assert.NoError(t, NewUTXOSet(bc).Rebuild())
+
+	t.Cleanup(func() {
+		_ = bc.db.Close()
+		_ = os.Chdir(wd)
+		_ = SelectParams(MainNetParams.Name)
+	})
+
+	return bc
+}
+
+func Test_ServerMinesPooledTransactions(t *testing.T) {
+	owner, miner := NewAccount(), NewAccount()
+	bc := newTestChain(t, owner)
+	n := NewServerWithBlockchain(bc, "test", miner.String())
+
+	tx, err := NewUTXOTransaction(owner, miner.String(), 3, n.us)
+	assert.NoError(t, err)
+	assert.NoError(t, n.acceptTx(tx))
+
+	block, err := n.mineBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, block.Height)
+	assert.True(t, block.Transactions[0].IsCoinbase(), "the coinbase comes first")
+	assert.Equal(t, tx.ID, block.Transactions[1].ID)
+
+	n.mempool.Remove(block.Transactions)
+	_, err = n.mineBlock()
+	assert.ErrorIs(t, err, errNoValidTxs)
+}
+
+// newPeerChain returns a blockchain holding only the genesis block of a new
+// chain bc, as a node about to sync from it.
+func newPeerChain(t *testing.T, bc *Blockchain) *Blockchain {
+	t.Helper()
+
+	genesis, err := bc.getBlockByKey(bc.tip)
+	assert.NoError(t, err)
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "peer.db"), 0600, nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	assert.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(genesis.Hash, genesis.Serialize()); err != nil {
+			return err
+		}
+		return b.Put([]byte(latestHashKey), genesis.Hash)
+	}))
+
+	peer := &Blockchain{tip: genesis.Hash, db: db, timeSource: NewMedianTime()}
+	assert.NoError(t, NewUTXOSet(peer).Rebuild())
+
+	return peer
+}
+
+func Test_SubmitUpdatesChainState(t *testing.T) {
+	owner, miner := NewAccount(), NewAccount()
+	bc := newTestChain(t, owner)
+	peer := newPeerChain(t, bc)
+	us := NewUTXOSet(bc)
+
+	tx, err := NewUTXOTransaction(owner, miner.String(), 3, us)
+	assert.NoError(t, err)
+	first, err := bc.Mine([]*Transaction{NewCoinbaseTx(miner.String(), "", 1), tx})
+	assert.NoError(t, err)
+	_, err = bc.Mine([]*Transaction{NewCoinbaseTx(miner.String(), "", 2), tx})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	second, err := bc.Mine([]*Transaction{NewCoinbaseTx(miner.String(), "", 2)})
+	assert.NoError(t, err)
+
+	// a syncing node connects the blocks one by one.
+	for _, block := range []*Block{first, second} {
+		assert.NoError(t, peer.Submit(block))
+		_, ok := peer.viewAt(peer.tip)(block.Transactions[0].ID)
+		assert.True(t, ok, "the chain state follows each block")
+	}
+	_, ok := peer.viewAt(peer.tip)(tx.Vin[0].TxId)
+	assert.False(t, ok, "spent outputs leave the chain state")
+}
+
+func Test_BumpFee(t *testing.T) {
+	owner, self, miner := NewAccount(), NewAccount(), NewAccount()
+	bc := newTestChain(t, owner)
+	us := NewUTXOSet(bc)
+	defer func(dust int) { activeParams.DustLimit = dust }(activeParams.DustLimit)
+	activeParams.DustLimit = 2
+
+	// a payment to another address of the wallet isn't change.
+	keys := accountKeyring([]*Account{owner, self})
+	tx, err := NewUTXOTransaction(owner, self.String(), 7, us, WithReplaceable(), WithChangeAddress(owner.String()))
+	assert.NoError(t, err)
+	assert.Len(t, tx.Vout, 2)
+
+	_, err = BumpFee(tx, keys, 2, 2, us)
+	assert.Error(t, err)
+	bumped, err := BumpFee(tx, keys, 2, 1, us)
+	assert.NoError(t, err)
+	assert.Len(t, bumped.Vout, 1, "change below the dust limit goes to the fee")
+	assert.Equal(t, 7, bumped.Vout[0].Value)
+	fee, err := us.Fee(bumped)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fee)
+
+	_, err = bc.Mine([]*Transaction{NewCoinbaseTx(miner.String(), "", 1), bumped})
+	assert.NoError(t, err)
+	_, err = BumpFee(tx, keys, 4, 1, us)
+	assert.ErrorIs(t, err, ErrMissingInput)
+}
+
+func Test_SubmitParentlessBlock(t *testing.T) {
+	miner := NewAccount()
+	bc := newTestChain(t, miner)
+
+	block := NewBlock([]*Transaction{NewCoinbaseTx(miner.String(), "", 5)}, nil, 5, bc.timeSource.Now())
+	assert.ErrorIs(t, bc.Submit(block), ErrOrphan)
+	assert.Equal(t, 0, bc.GetBestHeight())
+
+	genesis := NewGenesisBlock(NewCoinbaseTx(miner.String(), "another genesis", 0))
+	assert.ErrorIs(t, bc.Submit(genesis), ErrOrphan, "another genesis block")
+}
+
+func Test_ConnectedSince(t *testing.T) {
+	owner, miner := NewAccount(), NewAccount()
+	bc := newTestChain(t, owner)
+	fork := newPeerChain(t, bc)
+
+	var main, side []*Block
+	for height := 1; height <= 3; height++ {
+		if height < 3 {
+			block, err := bc.Mine([]*Transaction{NewCoinbaseTx(owner.String(), "", height)})
+			assert.NoError(t, err)
+			main = append(main, block)
+		}
+		block, err := fork.Mine([]*Transaction{NewCoinbaseTx(miner.String(), "", height)})
+		assert.NoError(t, err)
+		side = append(side, block)
+	}
+
+	tip := main[1].Hash
+	for _, block := range side[:2] {
+		assert.NoError(t, bc.Submit(block))
+		connected, err := bc.connectedSince(tip)
+		assert.NoError(t, err)
+		assert.Empty(t, connected, "side branch blocks aren't connected")
+	}
+
+	assert.NoError(t, bc.Submit(side[2]))
+	connected, err := bc.connectedSince(tip)
+	assert.NoError(t, err)
+	assert.Len(t, connected, len(side), "the reorg connects the whole branch")
+	for i := range connected {
+		assert.Equal(t, side[i].Hash, connected[i].Hash)
+	}
+}
+
+func Test_NewBlockchainVersion(t *testing.T) {
+	bc := newTestChain(t, NewAccount())
+	assert.NoError(t, bc.db.Close())
+
+	reopened, err := NewBlockchain("test")
+	assert.NoError(t, err)
+	assert.Equal(t, bc.tip, reopened.tip)
+	assert.NoError(t, reopened.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(blocksBucket)).Delete([]byte(versionKey))
+	}))
+	assert.NoError(t, reopened.db.Close())
+
+	// chains written before the version key have the old format.
+	_, err = NewBlockchain("test")
+	assert.ErrorContains(t, err, "old format")
+}
+
+func Test_MineLockTimeUsesMedianTimePast(t *testing.T) {
+	owner, miner := NewAccount(), NewAccount()
+	bc := newTestChain(t, owner)
+	genesis, err := bc.getBlockByKey(bc.tip)
+	assert.NoError(t, err)
+
+	// the new block is stamped after the genesis block, but the lock time
+	// is compared to the median time past, which is the genesis timestamp.
+	tx, err := NewUTXOTransaction(owner, miner.String(), 3, NewUTXOSet(bc), WithLockTime(genesis.Timestamp))
+	assert.NoError(t, err)
+	_, err = bc.Mine([]*Transaction{NewCoinbaseTx(miner.String(), "", 1), tx})
+	assert.ErrorIs(t, err, ErrTxNotFinal)
+}
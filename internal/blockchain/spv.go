@@ -0,0 +1,454 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const trackedTxsFilename = "zblock/dbs/tracked_%s.dat"
+
+const (
+	// maxOrphanProofs bounds the proofs kept until the headers of their
+	// blocks arrive.
+	maxOrphanProofs = 100
+	// maxPeerOrphanProofs bounds the orphan proofs kept from one peer.
+	maxPeerOrphanProofs = 20
+	// maxOrphanDistance is how far past the best header an orphan proof may
+	// be, peers push proofs of the blocks just mined.
+	maxOrphanDistance = 6
+)
+
+// TrackedTx is a transaction followed by a light client, Proof is set once a
+// peer proved the block it is in.
+type TrackedTx struct {
+	Proof *TxProof
+}
+
+// LoadTrackedTxs returns the transactions followed by the light client node,
+// by id.
+func LoadTrackedTxs(node string) (map[string]*TrackedTx, error) {
+	txs := make(map[string]*TrackedTx)
+
+	content, err := os.ReadFile(activeParams.dataFile(trackedTxsFilename, node))
+	if os.IsNotExist(err) {
+		return txs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&txs); err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+func saveTrackedTxs(node string, txs map[string]*TrackedTx) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(txs); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(activeParams.dataFile(trackedTxsFilename, node), buf.Bytes())
+}
+
+// TrackTx makes the light client node follow the transaction id.
+func TrackTx(node string, id []byte) error {
+	txs, err := LoadTrackedTxs(node)
+	if err != nil {
+		return err
+	}
+
+	txID := hex.EncodeToString(id)
+	if _, ok := txs[txID]; ok {
+		return nil
+	}
+	txs[txID] = &TrackedTx{}
+
+	return saveTrackedTxs(node, txs)
+}
+
+// Confirmations returns the number of headers on top of the block of a proof,
+// including it, or 0 when the block is not in the best header chain.
+func (s *HeaderStore) Confirmations(proof *TxProof) int {
+	if proof == nil {
+		return 0
+	}
+
+	_, hash, ok := s.Header(proof.Height)
+	if !ok || !bytes.Equal(hash, proof.BlockHash) {
+		return 0
+	}
+
+	return s.Height() - proof.Height + 1
+}
+
+// LightClient syncs only the block headers from full nodes and checks the
+// tracked transactions with merkle proofs against them, instead of storing
+// whole blocks. It loads a bloom filter of its wallet on its peers, which then
+// push the proofs of the wallet transactions. It trusts the genesis header of
+// the first peer it syncs from.
+type LightClient struct {
+	Id string
+
+	endpoints []string
+	endpoint  string
+
+	mu      sync.Mutex
+	headers *HeaderStore
+	// addresses are the wallet addresses the client follows.
+	addresses map[string]bool
+	// filtered are the peers the wallet filter was loaded on.
+	filtered map[string]bool
+	// orphans are the proofs of blocks past the best header, oldest first.
+	orphans []orphanProof
+}
+
+// orphanProof is a proof waiting for the header of its block.
+type orphanProof struct {
+	from  string
+	proof *TxProof
+}
+
+// NewLightClient returns the light client node id.
+func NewLightClient(id string) (*LightClient, error) {
+	headers, err := OpenHeaderStore(id)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := NewWallet(id)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	addresses := make(map[string]bool)
+	for _, address := range wallet.GetAddresses() {
+		addresses[address] = true
+	}
+
+	return &LightClient{
+		Id:        id,
+		endpoints: []string{fmt.Sprintf("localhost:%s", activeParams.DefaultPort)},
+		endpoint:  fmt.Sprintf("localhost:%s", id),
+		headers:   headers,
+		addresses: addresses,
+		filtered:  make(map[string]bool),
+	}, nil
+}
+
+// Start starts the light client, it syncs from the seed node.
+func (c *LightClient) Start() error {
+	if c.endpoint == c.endpoints[0] {
+		return fmt.Errorf("a light client can't be the seed node")
+	}
+
+	ln, err := net.Listen("tcp", c.endpoint)
+	if err != nil {
+		return err
+	}
+	defer func(ln net.Listener) {
+		_ = ln.Close()
+	}(ln)
+
+	c.sendVersion(c.endpoints[0])
+	c.sendGetHeaders(c.endpoints[0])
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go c.handleConn(conn)
+	}
+}
+
+func (c *LightClient) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	cmd, req, err := readMessage(conn)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch cmd {
+	case VersionCmd:
+		c.handleVersion(req)
+	case AddrCmd:
+		c.handleAddr(req)
+	case InvCmd:
+		c.handleInv(req)
+	case HeadersCmd:
+		c.handleHeaders(req)
+	case TxProofCmd:
+		c.handleTxProof(req)
+	default:
+		// light clients don't serve blocks or relay transactions.
+	}
+}
+
+func (c *LightClient) hasEndpoint(addr string) bool {
+	for _, endpoint := range c.endpoints {
+		if endpoint == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *LightClient) send(endpoint string, v []byte) {
+	if err := sendMessage(endpoint, v); err != nil {
+		log.Printf("%s is not available\n", endpoint)
+	}
+}
+
+func (c *LightClient) sendVersion(addr string) {
+	payload := encode(versionReq{
+		Version:    nodeVersion,
+		BestHeight: c.headers.Height(),
+		FromAddr:   c.endpoint,
+		Timestamp:  time.Now().Unix(),
+	})
+	c.send(addr, append(cmdToBytes(VersionCmd), payload...))
+}
+
+func (c *LightClient) sendGetHeaders(addr string) {
+	payload := encode(getHeadersReq{
+		FromAddr: c.endpoint,
+		Locator:  c.headers.Locator(),
+	})
+	c.send(addr, append(cmdToBytes(GetHeadersCmd), payload...))
+}
+
+func (c *LightClient) sendGetTxProof(addr string, txID []byte) {
+	payload := encode(getTxProofReq{
+		FromAddr: c.endpoint,
+		TxID:     txID,
+	})
+	c.send(addr, append(cmdToBytes(GetTxProofCmd), payload...))
+}
+
+// requestProofs asks addr for the proofs of the tracked transactions that
+// aren't in a block of the best header chain.
+func (c *LightClient) requestProofs(addr string) {
+	txs, err := LoadTrackedTxs(c.Id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for txID, tracked := range txs {
+		if c.headers.Confirmations(tracked.Proof) == 0 {
+			id, _ := hex.DecodeString(txID)
+			c.sendGetTxProof(addr, id)
+		}
+	}
+}
+
+func (c *LightClient) handleVersion(v []byte) {
+	var payload versionReq
+	if err := gob.NewDecoder(bytes.NewReader(v[cmdLength:])).Decode(&payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.headers.timeSource.AddSample(payload.FromAddr, payload.Timestamp)
+	if !c.hasEndpoint(payload.FromAddr) {
+		c.endpoints = append(c.endpoints, payload.FromAddr)
+	}
+	if payload.BestHeight > c.headers.Height() {
+		c.sendGetHeaders(payload.FromAddr)
+	}
+}
+
+func (c *LightClient) handleAddr(v []byte) {
+	var payload addrReq
+	if err := gob.NewDecoder(bytes.NewReader(v[cmdLength:])).Decode(&payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, addr := range payload.Values {
+		if addr != c.endpoint && !c.hasEndpoint(addr) {
+			c.endpoints = append(c.endpoints, addr)
+		}
+	}
+}
+
+func (c *LightClient) handleInv(v []byte) {
+	var payload invReq
+	if err := gob.NewDecoder(bytes.NewReader(v[cmdLength:])).Decode(&payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if payload.Kind == "block" {
+		c.sendGetHeaders(payload.FromAddr)
+	}
+}
+
+func (c *LightClient) handleHeaders(v []byte) {
+	var payload headersReq
+	if err := gob.NewDecoder(bytes.NewReader(v[cmdLength:])).Decode(&payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	added, err := c.headers.Connect(payload.StartHeight, payload.Headers)
+	if err != nil {
+		log.Printf("Reject headers from %s: %v\n", payload.FromAddr, err)
+		return
+	}
+	if added > 0 {
+		log.Printf("Synced %d headers, best height is %d\n", added, c.headers.Height())
+	}
+
+	if len(payload.Headers) >= maxHeadersPerMsg {
+		c.sendGetHeaders(payload.FromAddr)
+		return
+	}
+
+	c.acceptOrphans()
+	if !c.filtered[payload.FromAddr] {
+		c.sendFilterLoad(payload.FromAddr)
+	}
+	c.requestProofs(payload.FromAddr)
+}
+
+func (c *LightClient) handleTxProof(v []byte) {
+	var payload txProofReq
+	err := gob.NewDecoder(bytes.NewReader(v[cmdLength:])).Decode(&payload)
+	if err != nil || payload.Proof == nil || payload.Proof.Tx == nil {
+		log.Println("drop malformed tx proof")
+		return
+	}
+
+	// filtered peers push proofs of new blocks before we have their header.
+	if payload.Proof.Height > c.headers.Height() {
+		c.addOrphan(payload.FromAddr, payload.Proof)
+		return
+	}
+
+	c.acceptProof(payload.FromAddr, payload.Proof)
+}
+
+// acceptProof records a proof of a tracked transaction, or of a transaction of
+// the wallet which is tracked from then on.
+func (c *LightClient) acceptProof(from string, proof *TxProof) {
+	// the proof only counts against a header of the best chain, never
+	// against the merkle root it carries.
+	header, hash, ok := c.headers.Header(proof.Height)
+	if !ok || !bytes.Equal(hash, proof.BlockHash) || !proof.Verify(header.MerkleRoot) {
+		log.Printf("Reject proof of %x from %s\n", proof.Tx.ID, from)
+		return
+	}
+
+	txs, err := LoadTrackedTxs(c.Id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	txID := hex.EncodeToString(proof.Tx.ID)
+	tracked, ok := txs[txID]
+	if !ok {
+		// filters match more than asked for.
+		if !c.isWalletTx(proof.Tx, txs) {
+			return
+		}
+		tracked = &TrackedTx{}
+		txs[txID] = tracked
+	}
+
+	tracked.Proof = proof
+	if err := saveTrackedTxs(c.Id, txs); err != nil {
+		log.Println(err)
+		return
+	}
+	log.Printf("Transaction %s is in block %x at height %d\n", txID, proof.BlockHash, proof.Height)
+}
+
+// addOrphan keeps a proof from peer until the header of its block arrives.
+// Proofs too far past the best header or past the peer's share are dropped,
+// the oldest proof makes room when the pool is full.
+func (c *LightClient) addOrphan(from string, proof *TxProof) {
+	if proof.Height > c.headers.Height()+maxOrphanDistance {
+		log.Printf("Drop proof of %x from %s, height %d is too far ahead\n", proof.Tx.ID, from, proof.Height)
+		return
+	}
+
+	count := 0
+	for _, orphan := range c.orphans {
+		if orphan.from == from {
+			count++
+		}
+	}
+	if count >= maxPeerOrphanProofs {
+		log.Printf("Drop proof of %x from %s, too many orphan proofs\n", proof.Tx.ID, from)
+		return
+	}
+
+	if len(c.orphans) >= maxOrphanProofs {
+		c.orphans = c.orphans[1:]
+	}
+	c.orphans = append(c.orphans, orphanProof{from: from, proof: proof})
+}
+
+// acceptOrphans retries the proofs that arrived before the headers of their
+// block, and drops the ones that are still not in the header chain.
+func (c *LightClient) acceptOrphans() {
+	orphans := c.orphans
+	c.orphans = nil
+
+	for _, orphan := range orphans {
+		if orphan.proof.Height <= c.headers.Height() {
+			c.acceptProof(orphan.from, orphan.proof)
+		}
+	}
+}
+
+// isWalletTx checks whether tx pays to the wallet or spends a tracked
+// transaction.
+func (c *LightClient) isWalletTx(tx *Transaction, tracked map[string]*TrackedTx) bool {
+	for i := range tx.Vout {
+		if c.addresses[tx.Vout[i].Address()] {
+			return true
+		}
+	}
+
+	for _, in := range tx.Vin {
+		if _, ok := tracked[hex.EncodeToString(in.TxId)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sendFilterLoad subscribes to the transactions of the wallet on addr.
+func (c *LightClient) sendFilterLoad(addr string) {
+	f, err := walletFilter(c.Id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	payload := encode(filterLoadReq{
+		FromAddr: c.endpoint,
+		Filter:   *f,
+	})
+	c.send(addr, append(cmdToBytes(FilterLoadCmd), payload...))
+	c.filtered[addr] = true
+}
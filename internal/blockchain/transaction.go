@@ -3,65 +3,147 @@ package blockchain
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/big"
 	"strings"
-
-	"github.com/sphierex/blockchain-go/pkg/base58"
 )
 
-const subsidy = 10
+const (
+	// MaxTxInSequenceNum is the sequence number of an input that opts out of
+	// lock time and replacement.
+	MaxTxInSequenceNum uint32 = 0xffffffff
+	// MaxRBFSequence is the highest sequence number that signals the
+	// transaction can be replaced by one paying a higher fee.
+	MaxRBFSequence uint32 = MaxTxInSequenceNum - 2
+)
 
 // TxInput represents a transaction input.
 type TxInput struct {
 	TxId      []byte
 	Vout      int
-	Signature []byte
-	PubKey    []byte
+	ScriptSig []byte
+	Sequence  uint32
 }
 
 // UsesKey checks whether the address initiated the transaction.
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := HashPubKey(in.PubKey)
+	data, err := pushedData(in.ScriptSig)
+	if err != nil || len(data) == 0 {
+		return false
+	}
+	lockingHash := HashPubKey(data[len(data)-1])
 
 	return bytes.Equal(lockingHash, pubKeyHash)
 }
 
 // TxOutput represents a transaction output.
 type TxOutput struct {
-	Value      int
-	PubKeyHash []byte
+	Value        int
+	ScriptPubKey []byte
 }
 
-// Lock signs the output.
+// Lock signs the output with the script matching the address kind.
 func (to *TxOutput) Lock(address []byte) {
-	pubKeyHash := base58.Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	to.PubKeyHash = pubKeyHash
+	addr, err := ValidateAddress(string(address))
+	if err != nil {
+		to.ScriptPubKey = nil
+		return
+	}
+	to.ScriptPubKey = addr.Script()
 }
 
 // IsLockedWithKey checks if the output can be used by the owner of the pubkey
 func (to *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Equal(to.PubKeyHash, pubKeyHash)
+	info := classifyScript(to.ScriptPubKey)
+	switch info.Class {
+	case pubKeyHashTy, lockTimeTy:
+		return bytes.Equal(info.PubKeyHash, pubKeyHash)
+	default:
+		return false
+	}
+}
+
+// IsLockedWithAddress checks if the output pays to the address.
+func (to *TxOutput) IsLockedWithAddress(address *Address) bool {
+	if address.Kind == ScriptHashAddress {
+		info := classifyScript(to.ScriptPubKey)
+		return info.Class == scriptHashTy && bytes.Equal(info.ScriptHash, address.Hash)
+	}
+
+	return to.IsLockedWithKey(address.Hash)
 }
 
 // NewTxOutput create a new TXOutput.
 func NewTxOutput(v int, address string) *TxOutput {
-	txo := &TxOutput{Value: v, PubKeyHash: nil}
+	txo := &TxOutput{Value: v, ScriptPubKey: nil}
 	txo.Lock([]byte(address))
 
 	return txo
 }
 
-// TxOutputs collects TXOutput
+// NewMultiSigTxOutput creates a TXOutput that needs required of the pubKeys to sign.
+func NewMultiSigTxOutput(v int, required int, pubKeys [][]byte) (*TxOutput, error) {
+	script, err := NewMultiSigScript(required, pubKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxOutput{Value: v, ScriptPubKey: script}, nil
+}
+
+// NewLockTimeTxOutput creates a TXOutput for address that can't be spent before lockTime.
+func NewLockTimeTxOutput(v int, address string, lockTime int64) (*TxOutput, error) {
+	addr, err := ValidateAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.Kind != PubKeyHashAddress {
+		return nil, fmt.Errorf("lock time outputs need a %s address", PubKeyHashAddress)
+	}
+
+	return &TxOutput{Value: v, ScriptPubKey: NewLockTimeScript(lockTime, addr.Hash)}, nil
+}
+
+// TxOutputs collects the unspent TXOutput of a transaction, Indexes holds
+// the position of each value in the transaction outputs. Height is the height
+// of the block of the transaction.
 type TxOutputs struct {
-	Values []TxOutput
+	Values   []TxOutput
+	Indexes  []int
+	Height   int
+	Coinbase bool
+}
+
+// IsMature checks whether the outputs can be spent in a block at height,
+// coinbase outputs must wait for CoinbaseMaturity blocks. The genesis
+// coinbase can't be reorganized away and is always mature.
+func (to *TxOutputs) IsMature(height int) bool {
+	return !to.Coinbase || to.Height == 0 || height-to.Height >= activeParams.CoinbaseMaturity
+}
+
+// Index returns the output index of Values[i] in its transaction.
+func (to *TxOutputs) Index(i int) int {
+	if i < len(to.Indexes) {
+		return to.Indexes[i]
+	}
+
+	return i
+}
+
+// Find returns the unspent output with index vout.
+func (to *TxOutputs) Find(vout int) (TxOutput, bool) {
+	for i, out := range to.Values {
+		if to.Index(i) == vout {
+			return out, true
+		}
+	}
+
+	return TxOutput{}, false
 }
 
 // Serialize serializes TXOutputs
@@ -82,13 +164,15 @@ func DeserializeTxOutputs(data []byte) TxOutputs {
 
 // Transaction represents a Bitcoin transaction.
 type Transaction struct {
-	ID   []byte
-	Vin  []TxInput
-	Vout []TxOutput
+	ID       []byte
+	Vin      []TxInput
+	Vout     []TxOutput
+	LockTime int64
 }
 
-// NewCoinbaseTx creates a new coinbase transaction
-func NewCoinbaseTx(to, data string) *Transaction {
+// NewCoinbaseTx creates a new coinbase transaction for the block at height,
+// its script pushes the height and then data.
+func NewCoinbaseTx(to, data string, height int) *Transaction {
 	if data == "" {
 		buf := make([]byte, 20)
 		_, _ = rand.Read(buf)
@@ -98,10 +182,10 @@ func NewCoinbaseTx(to, data string) *Transaction {
 	txIn := TxInput{
 		TxId:      []byte{},
 		Vout:      -1,
-		Signature: nil,
-		PubKey:    []byte(data),
+		ScriptSig: NewScriptBuilder().AddInt64(int64(height)).AddData([]byte(data)).Script(),
+		Sequence:  MaxTxInSequenceNum,
 	}
-	txOut := NewTxOutput(subsidy, to)
+	txOut := NewTxOutput(activeParams.CalcBlockSubsidy(height), to)
 	tx := Transaction{
 		ID:   nil,
 		Vin:  []TxInput{txIn},
@@ -112,6 +196,45 @@ func NewCoinbaseTx(to, data string) *Transaction {
 	return &tx
 }
 
+// IsFinal checks whether the transaction may be included in a block at
+// height whose previous blocks have medianTimePast. A lock time below
+// 500000000 is a block height, otherwise it is a unix timestamp compared to
+// the median time past, which unlike a block's own timestamp miners can't
+// move ahead, and inputs with the maximum sequence number disable it.
+func (tx *Transaction) IsFinal(height int, medianTimePast int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	limit := int64(height)
+	if tx.LockTime >= lockTimeThreshold {
+		limit = medianTimePast
+	}
+	if tx.LockTime < limit {
+		return true
+	}
+
+	for _, in := range tx.Vin {
+		if in.Sequence != MaxTxInSequenceNum {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SignalsReplacement checks whether the transaction opted in to be replaced
+// by a conflicting one paying a higher fee.
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, in := range tx.Vin {
+		if in.Sequence <= MaxRBFSequence {
+			return true
+		}
+	}
+
+	return false
+}
+
 // IsCoinbase checks whether the transaction is coinbase.
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].TxId) == 0 && tx.Vin[0].Vout == -1
@@ -125,95 +248,231 @@ func (tx *Transaction) Serialize() []byte {
 	return buf.Bytes()
 }
 
-// Hash returns the hash of the Transaction.
-func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+// computeID returns the id a transaction must have: the hash of a coinbase,
+// which commits to its height, or of the unsigned transaction otherwise since
+// ids are set before the inputs are signed.
+func (tx *Transaction) computeID() []byte {
+	if tx.IsCoinbase() {
+		return tx.Hash()
+	}
 
-	txCopy := *tx
-	txCopy.ID = []byte{}
+	unsigned := tx.TrimmedCopy()
 
-	hash = sha256.Sum256(txCopy.Serialize())
+	return unsigned.Hash()
+}
+
+// HashData returns the transaction in the fixed layout that ids, signatures
+// and merkle roots hash: the input count, each input's id, output index,
+// script and sequence, the output count, each output's value and script,
+// then the lock time. Integers are little endian, counts and byte strings
+// are prefixed with their length as a uvarint. The ID is left out.
+func (tx *Transaction) HashData() []byte {
+	var data []byte
+
+	data = binary.AppendUvarint(data, uint64(len(tx.Vin)))
+	for _, in := range tx.Vin {
+		data = appendBytes(data, in.TxId)
+		data = binary.LittleEndian.AppendUint64(data, uint64(in.Vout))
+		data = appendBytes(data, in.ScriptSig)
+		data = binary.LittleEndian.AppendUint32(data, in.Sequence)
+	}
+
+	data = binary.AppendUvarint(data, uint64(len(tx.Vout)))
+	for _, out := range tx.Vout {
+		data = binary.LittleEndian.AppendUint64(data, uint64(out.Value))
+		data = appendBytes(data, out.ScriptPubKey)
+	}
+
+	return binary.LittleEndian.AppendUint64(data, uint64(tx.LockTime))
+}
+
+// appendBytes appends b to data prefixed with its length.
+func appendBytes(data, b []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(b)))
+
+	return append(data, b...)
+}
+
+// Hash returns the hash of the Transaction.
+func (tx *Transaction) Hash() []byte {
+	hash := sha256.Sum256(tx.HashData())
 
 	return hash[:]
 }
 
-// Sign signs each input of a Transaction.
+// Sign signs each input of a Transaction that privateKey can unlock. Inputs
+// locked to a multisig script collect one signature per call.
 func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTxs map[string]Transaction) error {
 	if tx.IsCoinbase() {
 		return nil //
 	}
 
 	for _, v := range tx.Vin {
-		if prevTxs[hex.EncodeToString(v.TxId)].ID == nil {
-			return fmt.Errorf("%s", "previous transaction is not correct")
+		if err := checkPrevOutput(v, prevTxs); err != nil {
+			return err
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	pubKey := pubKeyBytes(&privateKey.PublicKey)
+	// the addresses of old wallets hash the shorter legacy encoding.
+	legacyPubKey := legacyPubKeyBytes(&privateKey.PublicKey)
 
-	for id, v := range txCopy.Vin {
-		prevTx := prevTxs[hex.EncodeToString(v.TxId)]
-		txCopy.Vin[id].Signature = nil
-		txCopy.Vin[id].PubKey = prevTx.Vout[v.Vout].PubKeyHash
+	for id, v := range tx.Vin {
+		prevOut := prevTxs[hex.EncodeToString(v.TxId)].Vout[v.Vout]
+		scriptCode := prevOut.ScriptPubKey
+
+		// pay-to-script-hash inputs carry their redeem script as the last push.
+		var redeemScript []byte
+		if info := classifyScript(scriptCode); info.Class == scriptHashTy {
+			data, _ := pushedData(v.ScriptSig)
+			if len(data) == 0 || !bytes.Equal(HashPubKey(data[len(data)-1]), info.ScriptHash) {
+				continue
+			}
+			redeemScript = data[len(data)-1]
+			scriptCode = redeemScript
+		}
 
-		buf := fmt.Sprintf("%x\n", txCopy)
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, []byte(buf))
+		script, err := tx.signScript(id, scriptCode, &privateKey, pubKey)
+		if err == nil && script == nil && !bytes.Equal(legacyPubKey, pubKey) {
+			script, err = tx.signScript(id, scriptCode, &privateKey, legacyPubKey)
+		}
 		if err != nil {
 			return err
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
-
-		tx.Vin[id].Signature = signature
-		txCopy.Vin[id].PubKey = nil
+		if script == nil {
+			continue
+		}
+		if redeemScript != nil {
+			script = append(script, NewScriptBuilder().AddData(redeemScript).Script()...)
+		}
+		tx.Vin[id].ScriptSig = script
 	}
 
 	return nil
 }
 
-// Verify verifies signatures of Transaction inputs.
+// SetRedeemScript attaches the redeem script needed to sign a
+// pay-to-script-hash input.
+func (tx *Transaction) SetRedeemScript(index int, redeemScript []byte) {
+	tx.Vin[index].ScriptSig = NewScriptBuilder().AddData(redeemScript).Script()
+}
+
+// signScript returns the unlocking script for input index when privateKey can
+// satisfy scriptCode, or nil when it can't.
+func (tx *Transaction) signScript(index int, scriptCode []byte, privateKey *ecdsa.PrivateKey, pubKey []byte) ([]byte, error) {
+	info := classifyScript(scriptCode)
+
+	switch info.Class {
+	case pubKeyHashTy, lockTimeTy:
+		if !bytes.Equal(info.PubKeyHash, HashPubKey(pubKey)) {
+			return nil, nil
+		}
+
+		signature, err := signHash(privateKey, tx.sigHash(index, scriptCode))
+		if err != nil {
+			return nil, err
+		}
+
+		return NewScriptBuilder().AddData(signature).AddData(pubKey).Script(), nil
+	case multiSigTy:
+		return tx.signMultiSig(index, scriptCode, info, privateKey, pubKey)
+	}
+
+	return nil, nil
+}
+
+// signMultiSig adds a signature to the multisig unlocking script of input index,
+// keeping the signatures that are already present in public key order. It
+// returns nil when pubKey is not part of the script.
+func (tx *Transaction) signMultiSig(index int, scriptCode []byte, info scriptInfo, privateKey *ecdsa.PrivateKey, pubKey []byte) ([]byte, error) {
+	member := false
+	for _, key := range info.PubKeys {
+		member = member || bytes.Equal(key, pubKey)
+	}
+	if !member {
+		return nil, nil
+	}
+
+	hash := tx.sigHash(index, scriptCode)
+	sigs := make([][]byte, len(info.PubKeys))
+
+	existing, _ := pushedData(tx.Vin[index].ScriptSig)
+	for _, sig := range existing {
+		for i, key := range info.PubKeys {
+			if sigs[i] == nil && verifySignature(key, sig, hash) {
+				sigs[i] = sig
+				break
+			}
+		}
+	}
+
+	for i, key := range info.PubKeys {
+		if bytes.Equal(key, pubKey) && sigs[i] == nil {
+			signature, err := signHash(privateKey, hash)
+			if err != nil {
+				return nil, err
+			}
+			sigs[i] = signature
+		}
+	}
+
+	builder := NewScriptBuilder().AddOp(op0)
+	count := 0
+	for _, sig := range sigs {
+		if sig != nil && count < info.Required {
+			builder.AddData(sig)
+			count++
+		}
+	}
+
+	return builder.Script(), nil
+}
+
+// Verify verifies the unlocking scripts of Transaction inputs.
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) (bool, error) {
 	if tx.IsCoinbase() {
 		return true, nil
 	}
 
 	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.TxId)].ID == nil {
-			return false, fmt.Errorf("%s", "previous transaction is not correct")
+		if err := checkPrevOutput(vin, prevTXs); err != nil {
+			return false, err
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
 	for id, v := range tx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(v.TxId)]
-		txCopy.Vin[id].Signature = nil
-		txCopy.Vin[id].PubKey = prevTx.Vout[v.Vout].PubKeyHash
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(v.Signature)
-		r.SetBytes(v.Signature[:(sigLen / 2)])
-		s.SetBytes(v.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(v.PubKey)
-		x.SetBytes(v.PubKey[:(keyLen / 2)])
-		y.SetBytes(v.PubKey[(keyLen / 2):])
-
-		dataToVerify := fmt.Sprintf("%x\n", txCopy)
-
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if ecdsa.Verify(&rawPubKey, []byte(dataToVerify), &r, &s) == false {
-			return false, fmt.Errorf("%s", "tx vin verification failed")
+		prevOut := prevTXs[hex.EncodeToString(v.TxId)].Vout[v.Vout]
+		if err := verifyScript(v.ScriptSig, prevOut.ScriptPubKey, tx, id); err != nil {
+			return false, fmt.Errorf("tx vin %d verification failed: %w", id, err)
 		}
-		txCopy.Vin[id].PubKey = nil
 	}
 
 	return true, nil
 }
 
+// checkPrevOutput checks that the output referenced by in is known.
+func checkPrevOutput(in TxInput, prevTxs map[string]Transaction) error {
+	prevTx := prevTxs[hex.EncodeToString(in.TxId)]
+	if prevTx.ID == nil {
+		return fmt.Errorf("%s", "previous transaction is not correct")
+	}
+	if in.Vout < 0 || in.Vout >= len(prevTx.Vout) {
+		return fmt.Errorf("previous transaction has no output %d", in.Vout)
+	}
+
+	return nil
+}
+
+// sigHash returns the hash signed for input index, where scriptCode is the
+// script being satisfied.
+func (tx *Transaction) sigHash(index int, scriptCode []byte) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.Vin[index].ScriptSig = scriptCode
+	hash := sha256.Sum256(txCopy.HashData())
+
+	return hash[:]
+}
+
 // TrimmedCopy creates a trimmed copy of Transaction to be used in signing.
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TxInput
@@ -221,19 +480,20 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 
 	for _, v := range tx.Vin {
 		inputs = append(inputs, TxInput{
-			TxId: v.TxId,
-			Vout: v.Vout,
+			TxId:     v.TxId,
+			Vout:     v.Vout,
+			Sequence: v.Sequence,
 		})
 	}
 
 	for _, v := range tx.Vout {
 		outputs = append(outputs, TxOutput{
-			Value:      v.Value,
-			PubKeyHash: v.PubKeyHash,
+			Value:        v.Value,
+			ScriptPubKey: v.ScriptPubKey,
 		})
 	}
 
-	txCopy := Transaction{ID: tx.ID, Vin: inputs, Vout: outputs}
+	txCopy := Transaction{ID: tx.ID, Vin: inputs, Vout: outputs, LockTime: tx.LockTime}
 
 	return txCopy
 }
@@ -243,62 +503,308 @@ func (tx *Transaction) String() string {
 	var builder strings.Builder
 
 	builder.WriteString(fmt.Sprintf("   Transaction %x:\n", tx.ID))
+	if tx.LockTime != 0 {
+		builder.WriteString(fmt.Sprintf("     LockTime: %d\n", tx.LockTime))
+	}
 	for i, input := range tx.Vin {
 		builder.WriteString(fmt.Sprintf("     Input %d:\n", i))
 		builder.WriteString(fmt.Sprintf("       TXID:      %x\n", input.TxId))
 		builder.WriteString(fmt.Sprintf("       Out:       %d\n", input.Vout))
-		builder.WriteString(fmt.Sprintf("       Signature: %x\n", input.Signature))
-		builder.WriteString(fmt.Sprintf("       PubKey:    %x\n", input.PubKey))
+		builder.WriteString(fmt.Sprintf("       Sequence:  %x\n", input.Sequence))
+		builder.WriteString(fmt.Sprintf("       Script:    %s\n", DisasmScript(input.ScriptSig)))
 	}
 
 	for i, output := range tx.Vout {
 		builder.WriteString(fmt.Sprintf("     Output %d:\n", i))
 		builder.WriteString(fmt.Sprintf("       Value:  %d\n", output.Value))
-		builder.WriteString(fmt.Sprintf("       Script: %x\n", output.PubKeyHash))
+		builder.WriteString(fmt.Sprintf("       Script: %s\n", DisasmScript(output.ScriptPubKey)))
 	}
 
 	return builder.String()
 }
 
+// TxOption configures a transaction built by NewUTXOTransaction.
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	lockTime      int64
+	fee           int
+	replaceable   bool
+	coinSelector  CoinSelector
+	dust          int
+	changeAddress string
+}
+
+// WithLockTime makes the transaction invalid before lockTime, a block height
+// below 500000000 and a unix timestamp otherwise.
+func WithLockTime(lockTime int64) TxOption {
+	return func(o *txOptions) {
+		o.lockTime = lockTime
+	}
+}
+
+// WithFee makes the transaction pay fee to the miner.
+func WithFee(fee int) TxOption {
+	return func(o *txOptions) {
+		o.fee = fee
+	}
+}
+
+// WithReplaceable lets the transaction be replaced by one paying a higher fee
+// until it is mined.
+func WithReplaceable() TxOption {
+	return func(o *txOptions) {
+		o.replaceable = true
+	}
+}
+
+// WithCoinSelection picks the outputs spent by the transaction with selector,
+// BranchAndBound by default.
+func WithCoinSelection(selector CoinSelector) TxOption {
+	return func(o *txOptions) {
+		o.coinSelector = selector
+	}
+}
+
+// WithDustThreshold sets the smallest output value worth spending or creating,
+// change below dust is given to the miner instead.
+func WithDustThreshold(dust int) TxOption {
+	return func(o *txOptions) {
+		o.dust = dust
+	}
+}
+
+// Payment is an amount paid to an address.
+type Payment struct {
+	To     string
+	Amount int
+}
+
+// WithChangeAddress sends the change to address instead of the first sender.
+func WithChangeAddress(address string) TxOption {
+	return func(o *txOptions) {
+		o.changeAddress = address
+	}
+}
+
 // NewUTXOTransaction creates a new transaction.
-func NewUTXOTransaction(account *Account, to string, amount int, UTXOSet *UTXOSet) (*Transaction, error) {
+func NewUTXOTransaction(account *Account, to string, amount int, UTXOSet *UTXOSet, opts ...TxOption) (*Transaction, error) {
+	return NewBatchTransaction([]*Account{account}, []Payment{{To: to, Amount: amount}}, UTXOSet, opts...)
+}
+
+// NewBatchTransaction creates a new transaction making every payment, with a
+// single change output and fee for the whole batch. It spends outputs of any
+// of accounts and sends the change to the first one unless WithChangeAddress
+// is given.
+func NewBatchTransaction(accounts []*Account, payments []Payment, UTXOSet *UTXOSet, opts ...TxOption) (*Transaction, error) {
+	if len(accounts) == 0 {
+		return nil, errors.New("no accounts to spend from")
+	}
+
+	from := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		from = append(from, account.String())
+	}
+
+	tx, err := NewUnsignedTransaction(from, payments, UTXOSet, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = UTXOSet.bc.SignTx(tx, accountKeyring(accounts))
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// NewUnsignedTransaction creates a new transaction like NewBatchTransaction
+// spending outputs of the from addresses, but leaves it unsigned so the keys
+// can stay on another node. Pay-to-script-hash addresses can be spent from,
+// SignTx attaches their redeem script.
+func NewUnsignedTransaction(from []string, payments []Payment, UTXOSet *UTXOSet, opts ...TxOption) (*Transaction, error) {
 	var inputs []TxInput
 	var outputs []TxOutput
 
-	pubKeyHash := HashPubKey(account.PublicKey)
-	quantity, validOutputs := UTXOSet.GetSpendableOutputs(pubKeyHash, amount)
-	if quantity < amount {
-		return nil, errors.New("not enough funds")
+	options := txOptions{coinSelector: BranchAndBound, dust: activeParams.DustLimit}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	// outputs below the dust limit are not valid.
+	options.dust = max(options.dust, activeParams.DustLimit)
+
+	// a lock time is only enforced when some input is not final.
+	sequence := MaxTxInSequenceNum
+	if options.lockTime != 0 {
+		sequence = MaxTxInSequenceNum - 1
+	}
+	if options.replaceable {
+		sequence = MaxRBFSequence
+	}
+	if options.fee < 0 {
+		return nil, errors.New("fee can't be negative")
+	}
+
+	if len(from) == 0 {
+		return nil, errors.New("no addresses to spend from")
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("no payments")
+	}
+	amount := 0
+	for _, p := range payments {
+		if p.Amount <= 0 {
+			return nil, fmt.Errorf("payment to %s must be positive", p.To)
+		}
+		if p.Amount < activeParams.DustLimit {
+			return nil, fmt.Errorf("%w: payment to %s is %d, min %d", ErrDust, p.To, p.Amount, activeParams.DustLimit)
+		}
+		if _, err := ValidateAddress(p.To); err != nil {
+			return nil, fmt.Errorf("payment to %s: %w", p.To, err)
+		}
+		amount += p.Amount
+	}
+
+	var spendable []Coin
+	for _, address := range from {
+		addr, err := ValidateAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		spendable = append(spendable, UTXOSet.FindAddressCoins(addr)...)
+	}
+
+	coins, err := options.coinSelector(spendable, amount+options.fee, options.dust)
+	if err != nil {
+		return nil, err
 	}
 
 	// Build a list of inputs.
-	for id, outs := range validOutputs {
-		txID, _ := hex.DecodeString(id)
-		for _, out := range outs {
-			input := TxInput{
-				TxId:      txID,
-				Vout:      out,
-				Signature: nil,
-				PubKey:    account.PublicKey,
+	quantity := 0
+	for _, coin := range coins {
+		input := TxInput{
+			TxId:      coin.TxId,
+			Vout:      coin.Vout,
+			ScriptSig: nil,
+			Sequence:  sequence,
+		}
+		inputs = append(inputs, input)
+		quantity += coin.Value
+	}
+
+	for _, p := range payments {
+		outputs = append(outputs, *NewTxOutput(p.Amount, p.To))
+	}
+
+	// change below the dust threshold goes to the miner.
+	changeAddress := options.changeAddress
+	if changeAddress == "" {
+		changeAddress = from[0]
+	}
+	if change := quantity - amount - options.fee; change > 0 && change >= options.dust {
+		outputs = append(outputs, *NewTxOutput(change, changeAddress))
+	}
+
+	tx := &Transaction{
+		ID:       nil,
+		Vin:      inputs,
+		Vout:     outputs,
+		LockTime: options.lockTime,
+	}
+	tx.ID = tx.Hash()
+
+	return tx, nil
+}
+
+// BumpFee rebuilds a replaceable transaction signed with keys so that it pays
+// fee. The output at index change, -1 when there is none, is the change: the
+// extra fee comes out of it and further outputs of the spending keys are spent
+// when it is too small. The other outputs are paid in full.
+func BumpFee(orig *Transaction, keys Keyring, fee int, change int, UTXOSet *UTXOSet) (*Transaction, error) {
+	if !orig.SignalsReplacement() {
+		return nil, errors.New("transaction is not replaceable")
+	}
+	if change < -1 || change >= len(orig.Vout) {
+		return nil, fmt.Errorf("transaction has no output %d", change)
+	}
+
+	oldFee, err := UTXOSet.Fee(orig)
+	if err != nil {
+		return nil, err
+	}
+	if fee <= oldFee {
+		return nil, fmt.Errorf("new fee must be higher than %d", oldFee)
+	}
+
+	var inputs []TxInput
+	var outputs []TxOutput
+	var owners [][]byte
+	used := make(map[string]bool)
+	quantity, payments := 0, 0
+
+	for _, in := range orig.Vin {
+		out, ok := UTXOSet.FindOutput(in.TxId, in.Vout)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingInput, outpoint(in))
+		}
+		quantity += out.Value
+		used[outpoint(in)] = true
+		inputs = append(inputs, TxInput{TxId: in.TxId, Vout: in.Vout, Sequence: in.Sequence})
+
+		for _, pubKeyHash := range classifyScript(out.ScriptPubKey).pubKeyHashes() {
+			if _, ok := keys.FindKey(pubKeyHash); ok {
+				owners = append(owners, pubKeyHash)
 			}
-			inputs = append(inputs, input)
 		}
 	}
+	if len(owners) == 0 {
+		return nil, errors.New("transaction does not spend outputs of the keys")
+	}
 
-	from := account.String()
-	outputs = append(outputs, *NewTxOutput(amount, to))
-	if quantity > amount {
-		outputs = append(outputs, *NewTxOutput(quantity-amount, from))
+	changeAddress := string(encodeAddress(activeParams.PubKeyHashAddrID, owners[0]))
+	for i, out := range orig.Vout {
+		if i == change {
+			changeAddress = out.Address()
+			continue
+		}
+
+		outputs = append(outputs, out)
+		payments += out.Value
+	}
+
+	if quantity < payments+fee {
+		for _, owner := range owners {
+			for _, coin := range UTXOSet.FindSpendableCoins(owner) {
+				in := TxInput{TxId: coin.TxId, Vout: coin.Vout, Sequence: orig.Vin[0].Sequence}
+				if used[outpoint(in)] || quantity >= payments+fee {
+					continue
+				}
+
+				used[outpoint(in)] = true
+				quantity += coin.Value
+				inputs = append(inputs, in)
+			}
+		}
+	}
+	if quantity < payments+fee {
+		return nil, ErrInsufficientFunds
+	}
+
+	// change below the dust threshold goes to the miner.
+	if change := quantity - payments - fee; change > 0 && change >= activeParams.DustLimit {
+		outputs = append(outputs, *NewTxOutput(change, changeAddress))
 	}
 
 	tx := &Transaction{
-		ID:   nil,
-		Vin:  inputs,
-		Vout: outputs,
+		ID:       nil,
+		Vin:      inputs,
+		Vout:     outputs,
+		LockTime: orig.LockTime,
 	}
 	tx.ID = tx.Hash()
 
-	err := UTXOSet.bc.SignTx(tx, account.PrivateKey)
+	err = UTXOSet.bc.SignTx(tx, keys)
 	if err != nil {
 		return nil, err
 	}
@@ -313,3 +819,17 @@ func DeserializeTx(v []byte) Transaction {
 
 	return tx
 }
+
+// ParseTx deserializes a transaction from an untrusted source, it fails when
+// the data doesn't decode or the id isn't the transaction's.
+func ParseTx(v []byte) (*Transaction, error) {
+	var tx Transaction
+	if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&tx); err != nil {
+		return nil, fmt.Errorf("transaction does not decode: %w", err)
+	}
+	if !bytes.Equal(tx.ID, tx.computeID()) {
+		return nil, fmt.Errorf("%w: %x", ErrBadTxID, tx.ID)
+	}
+
+	return &tx, nil
+}
@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/sphierex/blockchain-go/pkg/merkle"
+)
+
+// errTxFound stops the chain scan once the transaction is found.
+var errTxFound = errors.New("transaction found")
+
+// TxProof proves a transaction is in a block without the rest of the block.
+type TxProof struct {
+	BlockHash  []byte
+	Height     int
+	MerkleRoot []byte
+	Tx         *Transaction
+	Index      int
+	// TxCount is the number of transactions in the block, it sets how long
+	// the path must be.
+	TxCount int
+	Path    []merkle.ProofStep
+}
+
+// Verify checks the proof against the merkle root of a block known to the
+// caller, usually taken from its header, that the transaction is at Index
+// of the TxCount transactions of the block.
+func (p *TxProof) Verify(merkleRoot []byte) bool {
+	return p.Tx != nil && merkle.VerifyProof(merkleRoot, p.Tx.HashData(), p.Index, p.TxCount, p.Path)
+}
+
+// GetTxProof builds the inclusion proof of the confirmed transaction id.
+func (bc *Blockchain) GetTxProof(id []byte) (*TxProof, error) {
+	var proof *TxProof
+
+	err := bc.Foreach(func(block *Block) error {
+		for i, tx := range block.Transactions {
+			if !bytes.Equal(tx.ID, id) {
+				continue
+			}
+
+			var err error
+			proof, err = block.TxProof(i)
+			if err != nil {
+				return err
+			}
+
+			return errTxFound
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errTxFound) {
+		return nil, err
+	}
+	if proof == nil {
+		return nil, fmt.Errorf("transaction %x is not in the chain", id)
+	}
+
+	return proof, nil
+}
+
+// TxProof builds the inclusion proof of the transaction at index.
+func (block *Block) TxProof(index int) (*TxProof, error) {
+	mTree := block.merkleTree()
+
+	path, err := mTree.Proof(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxProof{
+		BlockHash:  block.Hash,
+		Height:     block.Height,
+		MerkleRoot: block.MerkleRoot,
+		Tx:         block.Transactions[index],
+		Index:      index,
+		TxCount:    len(block.Transactions),
+		Path:       path,
+	}, nil
+}
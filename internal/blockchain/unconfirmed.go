@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"errors"
+
+	"go.etcd.io/bbolt"
+)
+
+const unconfirmedBucket = "unconfirmed"
+
+// SaveUnconfirmed keeps a transaction sent from this node until it is mined,
+// so that it can be replaced later.
+func (bc *Blockchain) SaveUnconfirmed(tx *Transaction) error {
+	return bc.db.Update(func(dbTx *bbolt.Tx) error {
+		b, err := dbTx.CreateBucketIfNotExists([]byte(unconfirmedBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(tx.ID, tx.Serialize())
+	})
+}
+
+// GetUnconfirmed returns a transaction saved by SaveUnconfirmed.
+func (bc *Blockchain) GetUnconfirmed(id []byte) (*Transaction, error) {
+	var tx *Transaction
+
+	err := bc.db.View(func(dbTx *bbolt.Tx) error {
+		b := dbTx.Bucket([]byte(unconfirmedBucket))
+		if b == nil {
+			return errors.New("transaction is not found")
+		}
+
+		data := b.Get(id)
+		if data == nil {
+			return errors.New("transaction is not found")
+		}
+		v := DeserializeTx(data)
+		tx = &v
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// DeleteUnconfirmed forgets a transaction saved by SaveUnconfirmed.
+func (bc *Blockchain) DeleteUnconfirmed(id []byte) error {
+	return bc.db.Update(func(dbTx *bbolt.Tx) error {
+		b := dbTx.Bucket([]byte(unconfirmedBucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete(id)
+	})
+}
@@ -1,14 +1,18 @@
 package blockchain
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
+	"fmt"
 
 	"go.etcd.io/bbolt"
 )
 
 const utxoBucket = "chain_state"
 
+var ErrMissingInput = errors.New("input is spent or unknown")
+
 // UTXOSet represents UTXO set.
 type UTXOSet struct {
 	bc *Blockchain
@@ -65,11 +69,44 @@ func (u *UTXOSet) Rebuild() error {
 	return nil
 }
 
+// utxoView looks up the unspent outputs of a transaction.
+type utxoView func(txID []byte) (TxOutputs, bool)
+
+// viewAt returns the outputs unspent on top of the block hash, read from the
+// chain state when it is the tip and replayed from the blocks otherwise.
+func (bc *Blockchain) viewAt(hash []byte) utxoView {
+	if !bytes.Equal(hash, bc.latestHash()) {
+		outputs := bc.unspentOutputsAt(hash)
+		return func(txID []byte) (TxOutputs, bool) {
+			outs, ok := outputs[hex.EncodeToString(txID)]
+			return outs, ok
+		}
+	}
+
+	return func(txID []byte) (TxOutputs, bool) {
+		var outs TxOutputs
+		found := false
+		_ = bc.db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(utxoBucket))
+			if b == nil {
+				return nil
+			}
+			if data := b.Get(txID); data != nil {
+				outs, found = DeserializeTxOutputs(data), true
+			}
+			return nil
+		})
+
+		return outs, found
+	}
+}
+
 // GetSpendableOutputs finds and returns unspent outputs to reference in inputs.
 func (u *UTXOSet) GetSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
 	unspentOutputs := make(map[string][]int)
 	accumulated := 0
 	db := u.bc.db
+	height := u.bc.GetBestHeight() + 1
 
 	_ = db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
@@ -78,10 +115,13 @@ func (u *UTXOSet) GetSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			txId := hex.EncodeToString(k)
 			outs := DeserializeTxOutputs(v)
-			for outIdx, out := range outs.Values {
+			if !outs.IsMature(height) {
+				continue
+			}
+			for i, out := range outs.Values {
 				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
 					accumulated += out.Value
-					unspentOutputs[txId] = append(unspentOutputs[txId], outIdx)
+					unspentOutputs[txId] = append(unspentOutputs[txId], outs.Index(i))
 				}
 			}
 		}
@@ -91,8 +131,52 @@ func (u *UTXOSet) GetSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 	return accumulated, unspentOutputs
 }
 
-// GetUTXO finds UTXO for a public key hash.
-func (u *UTXOSet) GetUTXO(pubKeyHash []byte) []TxOutput {
+// FindSpendableCoins returns the unspent outputs locked with pubKeyHash that
+// can be spent in the next block.
+func (u *UTXOSet) FindSpendableCoins(pubKeyHash []byte) []Coin {
+	return u.findCoins(func(out *TxOutput) bool {
+		return out.IsLockedWithKey(pubKeyHash)
+	})
+}
+
+// FindAddressCoins returns the unspent outputs paying to address, of any
+// kind, that can be spent in the next block.
+func (u *UTXOSet) FindAddressCoins(address *Address) []Coin {
+	return u.findCoins(func(out *TxOutput) bool {
+		return out.IsLockedWithAddress(address)
+	})
+}
+
+// findCoins returns the mature unspent outputs matching locked.
+func (u *UTXOSet) findCoins(locked func(out *TxOutput) bool) []Coin {
+	var coins []Coin
+	height := u.bc.GetBestHeight() + 1
+
+	_ = u.bc.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeTxOutputs(v)
+			if !outs.IsMature(height) {
+				continue
+			}
+			for i, out := range outs.Values {
+				if locked(&out) {
+					txID := append([]byte{}, k...)
+					coins = append(coins, Coin{TxId: txID, Vout: outs.Index(i), Value: out.Value})
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return coins
+}
+
+// GetUTXO finds UTXO for an address.
+func (u *UTXOSet) GetUTXO(address *Address) []TxOutput {
 	var result []TxOutput
 	db := u.bc.db
 	_ = db.View(func(tx *bbolt.Tx) error {
@@ -102,7 +186,7 @@ func (u *UTXOSet) GetUTXO(pubKeyHash []byte) []TxOutput {
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			outs := DeserializeTxOutputs(v)
 			for _, out := range outs.Values {
-				if out.IsLockedWithKey(pubKeyHash) {
+				if out.IsLockedWithAddress(address) {
 					result = append(result, out)
 				}
 			}
@@ -114,6 +198,96 @@ func (u *UTXOSet) GetUTXO(pubKeyHash []byte) []TxOutput {
 	return result
 }
 
+// GetBalance returns the value of the unspent outputs of address that can be
+// spent in the next block, and of the immature coinbase outputs.
+func (u *UTXOSet) GetBalance(address *Address) (int, int) {
+	spendable, immature := 0, 0
+	height := u.bc.GetBestHeight() + 1
+
+	_ = u.bc.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeTxOutputs(v)
+			for _, out := range outs.Values {
+				if !out.IsLockedWithAddress(address) {
+					continue
+				}
+				if outs.IsMature(height) {
+					spendable += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return spendable, immature
+}
+
+// FindOutput returns the unspent output vout of the transaction txID.
+func (u *UTXOSet) FindOutput(txID []byte, vout int) (TxOutput, bool) {
+	var out TxOutput
+	found := false
+
+	_ = u.bc.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		outsBytes := b.Get(txID)
+		if outsBytes == nil {
+			return nil
+		}
+
+		outs := DeserializeTxOutputs(outsBytes)
+		out, found = outs.Find(vout)
+
+		return nil
+	})
+
+	return out, found
+}
+
+// Fee returns the fee paid by a transaction spending unspent outputs.
+func (u *UTXOSet) Fee(tx *Transaction) (int, error) {
+	return u.FeeWithParents(tx, nil)
+}
+
+// FeeWithParents returns the fee paid by a transaction spending unspent
+// outputs or outputs of its unconfirmed parents.
+func (u *UTXOSet) FeeWithParents(tx *Transaction, parents map[string]*Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	fee := 0
+	for _, in := range tx.Vin {
+		var out TxOutput
+		ok := false
+		if parent, found := parents[hex.EncodeToString(in.TxId)]; found {
+			if in.Vout >= 0 && in.Vout < len(parent.Vout) {
+				out, ok = parent.Vout[in.Vout], true
+			}
+		} else {
+			out, ok = u.FindOutput(in.TxId, in.Vout)
+		}
+		if !ok {
+			return 0, fmt.Errorf("%w: %x:%d", ErrMissingInput, in.TxId, in.Vout)
+		}
+		fee += out.Value
+	}
+	for _, out := range tx.Vout {
+		fee -= out.Value
+	}
+
+	if fee < 0 {
+		return 0, fmt.Errorf("transaction %x spends more than its inputs", tx.ID)
+	}
+
+	return fee, nil
+}
+
 // TxCount returns the number of transactions in the UTXO set.
 func (u *UTXOSet) TxCount() int {
 	db := u.bc.db
@@ -141,17 +315,21 @@ func (u *UTXOSet) Update(block *Block) error {
 	db := u.bc.db
 
 	err := db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+		b, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
+		if err != nil {
+			return err
+		}
 		for _, tx := range block.Transactions {
 			if tx.IsCoinbase() == false {
 				for _, vin := range tx.Vin {
-					updatedOuts := TxOutputs{}
 					outsBytes := b.Get(vin.TxId)
 					outs := DeserializeTxOutputs(outsBytes)
+					updatedOuts := TxOutputs{Height: outs.Height, Coinbase: outs.Coinbase}
 
-					for outIdx, out := range outs.Values {
-						if outIdx != vin.Vout {
+					for i, out := range outs.Values {
+						if outs.Index(i) != vin.Vout {
 							updatedOuts.Values = append(updatedOuts.Values, out)
+							updatedOuts.Indexes = append(updatedOuts.Indexes, outs.Index(i))
 						}
 					}
 
@@ -169,9 +347,10 @@ func (u *UTXOSet) Update(block *Block) error {
 				}
 			}
 
-			newOutputs := TxOutputs{}
-			for _, out := range tx.Vout {
+			newOutputs := TxOutputs{Height: block.Height, Coinbase: tx.IsCoinbase()}
+			for outIdx, out := range tx.Vout {
 				newOutputs.Values = append(newOutputs.Values, out)
+				newOutputs.Indexes = append(newOutputs.Indexes, outIdx)
 			}
 
 			err := b.Put(tx.ID, newOutputs.Serialize())
@@ -0,0 +1,393 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// medianTimeBlocks is the number of blocks whose median timestamp the
+	// next block must be stamped after.
+	medianTimeBlocks = 11
+	// maxFutureBlockTime bounds how far past the network adjusted time a
+	// block may be stamped.
+	maxFutureBlockTime = 2 * 60 * 60
+)
+
+var (
+	ErrInvalidPoW = errors.New("block hash does not satisfy proof of work")
+	ErrTxNotFinal = errors.New("transaction is not final")
+	ErrMutated    = errors.New("block repeats transactions in its merkle tree")
+	ErrBadMerkle  = errors.New("merkle root does not match the transactions")
+	ErrBadHash    = errors.New("block hash does not match its header")
+	ErrOversize   = errors.New("size limit exceeded")
+	ErrDust       = errors.New("output is below the dust limit")
+	ErrTimeTooOld = errors.New("block time is not after the median time past")
+	ErrTimeTooNew = errors.New("block time is too far in the future")
+	ErrOrphan     = errors.New("block does not connect to a known block")
+	ErrImmature   = errors.New("coinbase output is not mature")
+	ErrCoinbase   = errors.New("block must start with its only coinbase")
+	ErrBadHeight  = errors.New("coinbase does not commit to the block height")
+	ErrDuplicate  = errors.New("transaction id is already unspent")
+	ErrCheckpoint = errors.New("block conflicts with a checkpoint")
+	ErrInvalidSig = errors.New("transaction inputs are not validly signed")
+	ErrBadTxID    = errors.New("transaction id is not its hash")
+	ErrSpentTwice = errors.New("output is spent twice in the block")
+	ErrOverspend  = errors.New("transaction pays more than its inputs")
+	ErrBadReward  = errors.New("coinbase pays more than the subsidy and fees")
+)
+
+// checkTxSanity checks the limits of the network on a transaction, whatever
+// the outputs it spends.
+func checkTxSanity(tx *Transaction) error {
+	if !bytes.Equal(tx.ID, tx.computeID()) {
+		return fmt.Errorf("%w: %x", ErrBadTxID, tx.ID)
+	}
+	if size := len(tx.Serialize()); size > activeParams.MaxTxSize {
+		return fmt.Errorf("%w: transaction %x is %d bytes, max %d", ErrOversize, tx.ID, size, activeParams.MaxTxSize)
+	}
+	if len(tx.Vin) == 0 || len(tx.Vout) == 0 {
+		return fmt.Errorf("transaction %x has no inputs or outputs", tx.ID)
+	}
+	if len(tx.Vin) > activeParams.MaxTxInputs {
+		return fmt.Errorf("%w: transaction %x has %d inputs, max %d", ErrOversize, tx.ID, len(tx.Vin), activeParams.MaxTxInputs)
+	}
+	if len(tx.Vout) > activeParams.MaxTxOutputs {
+		return fmt.Errorf("%w: transaction %x has %d outputs, max %d", ErrOversize, tx.ID, len(tx.Vout), activeParams.MaxTxOutputs)
+	}
+
+	for i, out := range tx.Vout {
+		if out.Value < 0 {
+			return fmt.Errorf("transaction %x output %d is negative", tx.ID, i)
+		}
+		if !tx.IsCoinbase() && out.Value < activeParams.DustLimit {
+			return fmt.Errorf("%w: transaction %x output %d is %d, min %d", ErrDust, tx.ID, i, out.Value, activeParams.DustLimit)
+		}
+	}
+
+	return nil
+}
+
+// checkBlockSize checks a block and its transactions are within the limits
+// of the network.
+func checkBlockSize(block *Block) error {
+	if size := len(block.Serialize()); size > activeParams.MaxBlockSize {
+		return fmt.Errorf("%w: block is %d bytes, max %d", ErrOversize, size, activeParams.MaxBlockSize)
+	}
+
+	for _, tx := range block.Transactions {
+		if err := checkTxSanity(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkHeader checks a block header carries the proof of work of the network.
+func checkHeader(h *BlockHeader) error {
+	if h.Bits != uint32(activeParams.PowLimitBits) {
+		return fmt.Errorf("%w: %d bits, want %d", ErrInvalidPoW, h.Bits, activeParams.PowLimitBits)
+	}
+	if !checkPoW(h.Hash()) {
+		return ErrInvalidPoW
+	}
+
+	return nil
+}
+
+// checkCoinbase checks the first transaction of a block at height, and only
+// it, is a coinbase, and that its script starts by pushing the height so that
+// no two coinbases share an id.
+func checkCoinbase(txs []*Transaction, height int) error {
+	if len(txs) == 0 || !txs[0].IsCoinbase() {
+		return ErrCoinbase
+	}
+	for _, tx := range txs[1:] {
+		if tx.IsCoinbase() {
+			return fmt.Errorf("%w: %x is a second coinbase", ErrCoinbase, tx.ID)
+		}
+	}
+
+	heightScript := NewScriptBuilder().AddInt64(int64(height)).Script()
+	if !bytes.HasPrefix(txs[0].Vin[0].ScriptSig, heightScript) {
+		return fmt.Errorf("%w: %d", ErrBadHeight, height)
+	}
+
+	return nil
+}
+
+// checkBlockTime checks a header is stamped after the median time past of the
+// blocks before it and not too far past the adjusted time now.
+func checkBlockTime(h *BlockHeader, medianTimePast, now int64) error {
+	if h.Timestamp <= medianTimePast {
+		return fmt.Errorf("%w: %d, median is %d", ErrTimeTooOld, h.Timestamp, medianTimePast)
+	}
+	if h.Timestamp > now+maxFutureBlockTime {
+		return fmt.Errorf("%w: %d, adjusted time is %d", ErrTimeTooNew, h.Timestamp, now)
+	}
+
+	return nil
+}
+
+// checkBlock checks the consensus rules a block must follow before it is
+// stored in the blockchain.
+func checkBlock(block *Block) error {
+	if err := checkHeader(&block.BlockHeader); err != nil {
+		return err
+	}
+	if !bytes.Equal(block.Hash, block.BlockHeader.Hash()) {
+		return ErrBadHash
+	}
+
+	if err := checkBlockSize(block); err != nil {
+		return err
+	}
+
+	mTree := block.merkleTree()
+	if mTree.Mutated {
+		return ErrMutated
+	}
+	if !bytes.Equal(mTree.RootNode.Data, block.MerkleRoot) {
+		return ErrBadMerkle
+	}
+	if err := checkCoinbase(block.Transactions, block.Height); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkBlockContext checks the rules of a block that depend on the blocks
+// before it, which must be known.
+func (bc *Blockchain) checkBlockContext(block *Block) error {
+	if err := checkCheckpoint(block.Height, block.Hash, bc.GetBestHeight()); err != nil {
+		return err
+	}
+	if len(block.PrevBlockHash) == 0 {
+		// only the genesis block has no parent.
+		if block.Height == 0 && bytes.Equal(block.Hash, bc.genesisHash()) {
+			return nil
+		}
+		return fmt.Errorf("%w: block %x has no parent", ErrOrphan, block.Hash)
+	}
+
+	parent, err := bc.getBlockByKey(block.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("%w: parent %x", ErrOrphan, block.PrevBlockHash)
+	}
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("block height %d does not follow its parent at %d", block.Height, parent.Height)
+	}
+
+	medianTimePast, err := bc.medianTimePast(block.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	if err := checkBlockTime(&block.BlockHeader, medianTimePast, bc.timeSource.Now()); err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		if !tx.IsFinal(block.Height, medianTimePast) {
+			return fmt.Errorf("%w: %x", ErrTxNotFinal, tx.ID)
+		}
+	}
+
+	if err := bc.checkCoinbaseSpends(block.Transactions, block.PrevBlockHash, block.Height); err != nil {
+		return err
+	}
+	view := bc.viewAt(block.PrevBlockHash)
+	if err := checkDuplicateTxs(view, block.Transactions); err != nil {
+		return err
+	}
+	if err := checkSpends(view, block.Transactions, block.Height); err != nil {
+		return err
+	}
+
+	if bc.assumedValid(block) {
+		// the inputs and values are checked all the same.
+		return nil
+	}
+
+	return bc.checkSignatures(block.Transactions)
+}
+
+// checkCheckpoint checks a block at height with hash is the checkpoint at its
+// height, if any, and doesn't fork the best chain, at bestHeight, below the
+// last checkpoint.
+func checkCheckpoint(height int, hash []byte, bestHeight int) error {
+	if cp, ok := activeParams.checkpoint(height); ok && !bytes.Equal(cp.Hash, hash) {
+		return fmt.Errorf("%w: block %x at height %d, want %x", ErrCheckpoint, hash, height, cp.Hash)
+	}
+	if last, ok := activeParams.lastCheckpoint(); ok && bestHeight >= last.Height && height <= last.Height {
+		return fmt.Errorf("%w: block %x forks below height %d", ErrCheckpoint, hash, last.Height)
+	}
+
+	return nil
+}
+
+// checkSignatures verifies the inputs of the transactions of a block, which
+// may spend outputs of the ones before them.
+func (bc *Blockchain) checkSignatures(txs []*Transaction) error {
+	parents := make(map[string]*Transaction)
+	for _, tx := range txs {
+		if !bc.VerifyTxWithParents(tx, parents) {
+			return fmt.Errorf("%w: %x", ErrInvalidSig, tx.ID)
+		}
+		parents[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	return nil
+}
+
+// checkDuplicateTxs checks no transaction has the id of one with unspent
+// outputs in view, which it would overwrite in the chain state.
+func checkDuplicateTxs(view utxoView, txs []*Transaction) error {
+	for _, tx := range txs {
+		if _, ok := view(tx.ID); ok {
+			return fmt.Errorf("%w: %x", ErrDuplicate, tx.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkCoinbaseSpends checks the transactions of a block at height on top of
+// the block prevHash spend no coinbase output before it is mature.
+func (bc *Blockchain) checkCoinbaseSpends(txs []*Transaction, prevHash []byte, height int) error {
+	immature := make(map[string]bool)
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			immature[string(tx.ID)] = true
+		}
+	}
+	// only the coinbases of the last blocks can be immature.
+	for len(prevHash) > 0 {
+		block, err := bc.getBlockByKey(prevHash)
+		if err != nil {
+			return err
+		}
+		if block.Height == 0 || height-block.Height >= activeParams.CoinbaseMaturity {
+			break
+		}
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				immature[string(tx.ID)] = true
+			}
+		}
+		prevHash = block.PrevBlockHash
+	}
+
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Vin {
+			if immature[string(in.TxId)] {
+				return fmt.Errorf("%w: transaction %x spends %x:%d", ErrImmature, tx.ID, in.TxId, in.Vout)
+			}
+		}
+	}
+
+	return nil
+}
+
+// medianTimePast returns the median timestamp of the medianTimeBlocks blocks
+// ending with the block hash.
+func (bc *Blockchain) medianTimePast(hash []byte) (int64, error) {
+	var timestamps []int64
+	for len(timestamps) < medianTimeBlocks && len(hash) > 0 {
+		block, err := bc.getBlockByKey(hash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, block.Timestamp)
+		hash = block.PrevBlockHash
+	}
+
+	return medianTimestamp(timestamps), nil
+}
+
+// checkSpends checks the transactions of a block at height against the
+// outputs unspent in view: each input spends an existing output no other
+// input of the block spends, no transaction pays more than it spends and the
+// coinbase claims at most the subsidy and the fees.
+func checkSpends(view utxoView, txs []*Transaction, height int) error {
+	spent := make(map[string]bool)
+	created := make(map[string]TxOutputs)
+	fees := 0
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			in := 0
+			for _, vin := range tx.Vin {
+				if spent[outpoint(vin)] {
+					return fmt.Errorf("%w: %s", ErrSpentTwice, outpoint(vin))
+				}
+				spent[outpoint(vin)] = true
+
+				outs, ok := created[string(vin.TxId)]
+				if !ok {
+					outs, ok = view(vin.TxId)
+				}
+				out, found := outs.Find(vin.Vout)
+				if !ok || !found {
+					return fmt.Errorf("%w: %s", ErrMissingInput, outpoint(vin))
+				}
+				in += out.Value
+			}
+
+			out := 0
+			for _, o := range tx.Vout {
+				out += o.Value
+			}
+			if out > in {
+				return fmt.Errorf("%w: %x pays %d out of %d", ErrOverspend, tx.ID, out, in)
+			}
+			fees += in - out
+		}
+
+		// later transactions of the block may spend the outputs.
+		var outs TxOutputs
+		for i, o := range tx.Vout {
+			outs.Values = append(outs.Values, o)
+			outs.Indexes = append(outs.Indexes, i)
+		}
+		created[string(tx.ID)] = outs
+	}
+
+	reward := 0
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			for _, o := range tx.Vout {
+				reward += o.Value
+			}
+		}
+	}
+	if limit := activeParams.CalcBlockSubsidy(height) + fees; reward > limit {
+		return fmt.Errorf("%w: %d, max %d", ErrBadReward, reward, limit)
+	}
+
+	return nil
+}
+
+// assumedValid checks whether the signatures of block are assumed valid: the
+// assume-valid block is in the header chain and block is one of its ancestors.
+func (bc *Blockchain) assumedValid(block *Block) bool {
+	av := activeParams.AssumeValid
+	if av == nil || bc.headers == nil || block.Height > av.Height {
+		return false
+	}
+
+	bc.headersMu.Lock()
+	defer bc.headersMu.Unlock()
+
+	if _, hash, ok := bc.headers.Header(av.Height); !ok || !bytes.Equal(hash, av.Hash) {
+		return false
+	}
+	// the headers link up to the assume-valid one.
+	_, hash, ok := bc.headers.Header(block.Height)
+
+	return ok && bytes.Equal(hash, block.Hash)
+}
@@ -2,24 +2,58 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/elliptic"
-	"encoding/gob"
+	"crypto/ecdsa"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"sort"
+	"time"
 )
 
 const wallerFilename = "zblock/wallets/wallet_%s.dat"
 
-// Wallet stores a collection of accounts.
+// Wallet stores a collection of accounts, the redeem scripts of the
+// pay-to-script-hash addresses it takes part in and the watch-only addresses
+// it tracks without their keys.
 type Wallet struct {
-	Accounts map[string]*Account
+	Accounts  map[string]*Account
+	Scripts   map[string][]byte
+	WatchOnly map[string]*WatchOnly
+	Info      map[string]*AddressInfo
+}
+
+// Purpose tells what a wallet address is used for.
+type Purpose string
+
+const (
+	// PurposeReceive addresses are handed out to receive payments.
+	PurposeReceive Purpose = "receive"
+	// PurposeChange addresses receive the change of the wallet transactions.
+	PurposeChange Purpose = "change"
+)
+
+// AddressInfo is the metadata the wallet keeps about one of its addresses.
+// Addresses of older wallets have none and a zero Created.
+type AddressInfo struct {
+	Label   string
+	Purpose Purpose
+	Created int64
+	Notes   string
+}
+
+// WatchOnly is an address tracked by the wallet without its private key,
+// PublicKey is set when it was imported from a public key.
+type WatchOnly struct {
+	Address   string
+	PublicKey []byte
 }
 
 // NewWallet creates Wallet and fills it from a file if it exists.
 func NewWallet(node string) (*Wallet, error) {
 	w := Wallet{}
 	w.Accounts = make(map[string]*Account)
+	w.Scripts = make(map[string][]byte)
+	w.WatchOnly = make(map[string]*WatchOnly)
+	w.Info = make(map[string]*AddressInfo)
 	err := w.Load(node)
 
 	return &w, err
@@ -29,16 +63,173 @@ func NewWallet(node string) (*Wallet, error) {
 func (w *Wallet) NewAccount() string {
 	account := NewAccount()
 	w.Accounts[account.String()] = account
+	w.addInfo(account.String(), PurposeReceive)
 
 	return account.String()
 }
 
-// GetAddresses returns an array of addresses stored in the wallet file
+// NewChangeAccount adds an Account receiving the change of a transaction to
+// Wallet.
+func (w *Wallet) NewChangeAccount() string {
+	account := NewAccount()
+	w.Accounts[account.String()] = account
+	w.addInfo(account.String(), PurposeChange)
+
+	return account.String()
+}
+
+// AddScript adds a redeem script to Wallet and returns its P2SH address.
+func (w *Wallet) AddScript(redeemScript []byte) string {
+	address := NewScriptHashAddress(redeemScript)
+	w.Scripts[address] = redeemScript
+	w.addInfo(address, PurposeReceive)
+
+	return address
+}
+
+// addInfo records when an address was added to Wallet and what for, it keeps
+// the metadata of addresses already known.
+func (w *Wallet) addInfo(address string, purpose Purpose) {
+	if w.Info == nil {
+		w.Info = make(map[string]*AddressInfo)
+	}
+	if _, ok := w.Info[address]; !ok {
+		w.Info[address] = &AddressInfo{Purpose: purpose, Created: time.Now().Unix()}
+	}
+}
+
+// GetInfo returns the metadata of a wallet address.
+func (w *Wallet) GetInfo(address string) AddressInfo {
+	if info, ok := w.Info[address]; ok {
+		return *info
+	}
+
+	return AddressInfo{}
+}
+
+// ChangeOutput returns the index of the output of tx paying to a change
+// address of the wallet, -1 when there is none.
+func (w *Wallet) ChangeOutput(tx *Transaction) int {
+	for i := range tx.Vout {
+		if w.GetInfo(tx.Vout[i].Address()).Purpose == PurposeChange {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// SetLabel sets the label and notes of a wallet address.
+func (w *Wallet) SetLabel(address, label, notes string) error {
+	if !w.has(address) {
+		return fmt.Errorf("address %s is not in the wallet", address)
+	}
+
+	w.addInfo(address, PurposeReceive)
+	w.Info[address].Label = label
+	w.Info[address].Notes = notes
+
+	return nil
+}
+
+// GetScript returns the redeem script of a P2SH address.
+func (w *Wallet) GetScript(address string) ([]byte, bool) {
+	script, ok := w.Scripts[address]
+
+	return script, ok
+}
+
+// ImportAddress adds a watch-only address to Wallet.
+func (w *Wallet) ImportAddress(address string) error {
+	if _, err := ValidateAddress(address); err != nil {
+		return err
+	}
+	if w.has(address) {
+		return fmt.Errorf("address %s is already in the wallet", address)
+	}
+
+	w.WatchOnly[address] = &WatchOnly{Address: address}
+	w.addInfo(address, PurposeReceive)
+
+	return nil
+}
+
+// ImportAccount adds an Account to Wallet, replacing a watch-only entry for
+// the same address, and returns its address.
+func (w *Wallet) ImportAccount(account *Account) string {
+	address := account.String()
+	delete(w.WatchOnly, address)
+	w.Accounts[address] = account
+	w.addInfo(address, PurposeReceive)
+
+	return address
+}
+
+// ImportPubKey adds the address of a public key to Wallet as watch-only and
+// returns it.
+func (w *Wallet) ImportPubKey(pubKey []byte) (string, error) {
+	if _, err := parsePubKey(pubKey); err != nil {
+		return "", err
+	}
+
+	address := string(encodeAddress(activeParams.PubKeyHashAddrID, HashPubKey(pubKey)))
+	if _, ok := w.Accounts[address]; ok {
+		return "", fmt.Errorf("address %s is already in the wallet", address)
+	}
+
+	w.WatchOnly[address] = &WatchOnly{Address: address, PublicKey: pubKey}
+	w.addInfo(address, PurposeReceive)
+
+	return address, nil
+}
+
+// GetPubKey returns the public key of an account or watch-only address.
+func (w *Wallet) GetPubKey(address string) ([]byte, bool) {
+	if account, ok := w.Accounts[address]; ok {
+		return account.PublicKey, true
+	}
+	if watched, ok := w.WatchOnly[address]; ok && watched.PublicKey != nil {
+		return watched.PublicKey, true
+	}
+
+	return nil, false
+}
+
+// IsWatchOnly checks whether the wallet tracks address without its key.
+func (w *Wallet) IsWatchOnly(address string) bool {
+	_, ok := w.WatchOnly[address]
+
+	return ok
+}
+
+// has checks whether address is in the wallet.
+func (w *Wallet) has(address string) bool {
+	_, account := w.Accounts[address]
+	_, script := w.Scripts[address]
+
+	return account || script || w.IsWatchOnly(address)
+}
+
+// GetAddresses returns the addresses stored in the wallet file, oldest first.
 func (w *Wallet) GetAddresses() []string {
 	var addresses []string
 	for address := range w.Accounts {
 		addresses = append(addresses, address)
 	}
+	for address := range w.Scripts {
+		addresses = append(addresses, address)
+	}
+	for address := range w.WatchOnly {
+		addresses = append(addresses, address)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		ci, cj := w.GetInfo(addresses[i]).Created, w.GetInfo(addresses[j]).Created
+		if ci != cj {
+			return ci < cj
+		}
+		return addresses[i] < addresses[j]
+	})
 
 	return addresses
 }
@@ -48,45 +239,66 @@ func (w *Wallet) GetAccount(address string) Account {
 	return *w.Accounts[address]
 }
 
-// Load loads accounts from the file
+// FindKey returns the private key of the account whose public key hashes to
+// pubKeyHash.
+func (w *Wallet) FindKey(pubKeyHash []byte) (*ecdsa.PrivateKey, bool) {
+	for _, account := range w.Accounts {
+		if key, ok := account.FindKey(pubKeyHash); ok {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// FindScript returns the redeem script hashing to scriptHash.
+func (w *Wallet) FindScript(scriptHash []byte) ([]byte, bool) {
+	for _, script := range w.Scripts {
+		if bytes.Equal(HashPubKey(script), scriptHash) {
+			return script, true
+		}
+	}
+
+	return nil, false
+}
+
+// Load loads accounts from the file, older wallet formats are migrated when
+// the wallet is saved again.
 func (w *Wallet) Load(node string) error {
-	walletFile := fmt.Sprintf(wallerFilename, node)
+	walletFile := activeParams.dataFile(wallerFilename, node)
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
 	}
 
-	content, err := ioutil.ReadFile(walletFile)
+	content, err := os.ReadFile(walletFile)
 	if err != nil {
 		return err
 	}
 
-	var wallet Wallet
-	gob.Register(elliptic.P256())
-	err = gob.NewDecoder(bytes.NewReader(content)).Decode(&wallet)
+	wallet, err := decodeWallet(content)
 	if err != nil {
 		return err
 	}
 
 	w.Accounts = wallet.Accounts
+	w.setMaps(wallet.Scripts, wallet.WatchOnly, wallet.Info)
 
 	return nil
 }
 
-// Save saves accounts to a file
+// Save saves accounts to a file. The previous file is backed up first and the
+// new one replaces it atomically.
 func (w *Wallet) Save(node string) error {
-	var buf bytes.Buffer
-	walletFile := fmt.Sprintf(wallerFilename, node)
+	walletFile := activeParams.dataFile(wallerFilename, node)
 
-	gob.Register(elliptic.P256())
-	err := gob.NewEncoder(&buf).Encode(w)
+	content, err := encodeWallet(w)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(walletFile, buf.Bytes(), 0644)
-	if err != nil {
+	if _, err := backupWalletFile(node); err != nil {
 		return err
 	}
 
-	return nil
+	return writeFileAtomic(walletFile, content)
 }
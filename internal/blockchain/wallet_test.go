@@ -0,0 +1,185 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WalletWatchOnly(t *testing.T) {
+	w := &Wallet{Accounts: make(map[string]*Account), Scripts: make(map[string][]byte), WatchOnly: make(map[string]*WatchOnly)}
+	own := w.NewAccount()
+	cold := NewAccount()
+
+	assert.Error(t, w.ImportAddress(own), "accounts are not watch-only")
+	assert.Error(t, w.ImportAddress("not an address"))
+
+	address, err := w.ImportPubKey(cold.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, cold.String(), address)
+	assert.True(t, w.IsWatchOnly(address))
+
+	pubKey, ok := w.GetPubKey(address)
+	assert.True(t, ok)
+	assert.Equal(t, cold.PublicKey, pubKey)
+
+	_, ok = w.FindKey(HashPubKey(cold.PublicKey))
+	assert.False(t, ok, "watch-only addresses can't sign")
+	assert.ElementsMatch(t, []string{own, address}, w.GetAddresses())
+
+	_, err = w.ImportPubKey([]byte{1, 2, 3})
+	assert.Error(t, err)
+}
+
+func Test_WalletLabels(t *testing.T) {
+	w := &Wallet{Accounts: make(map[string]*Account), Scripts: make(map[string][]byte), WatchOnly: make(map[string]*WatchOnly)}
+	receive := w.NewAccount()
+	change := w.NewChangeAccount()
+
+	assert.Equal(t, PurposeReceive, w.GetInfo(receive).Purpose)
+	assert.Equal(t, PurposeChange, w.GetInfo(change).Purpose)
+	assert.NotZero(t, w.GetInfo(change).Created)
+
+	assert.NoError(t, w.SetLabel(change, "savings", "cold storage top-up"))
+	assert.Equal(t, "savings", w.GetInfo(change).Label)
+	assert.Equal(t, PurposeChange, w.GetInfo(change).Purpose, "labelling keeps the purpose")
+	assert.Error(t, w.SetLabel(NewAccount().String(), "unknown", ""))
+
+	// addresses with the same creation time are ordered by address.
+	w.Info[receive].Created, w.Info[change].Created = 1, 1
+	expected := []string{receive, change}
+	if change < receive {
+		expected = []string{change, receive}
+	}
+	assert.Equal(t, expected, w.GetAddresses())
+
+	w.Info[receive].Created = 2
+	assert.Equal(t, []string{change, receive}, w.GetAddresses())
+}
+
+func Test_WalletFileFormat(t *testing.T) {
+	w := &Wallet{Accounts: make(map[string]*Account), Scripts: make(map[string][]byte), WatchOnly: make(map[string]*WatchOnly)}
+	address := w.NewAccount()
+	assert.NoError(t, w.ImportAddress(NewAccount().String()))
+	assert.NoError(t, w.SetLabel(address, "main", ""))
+
+	content, err := encodeWallet(w)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(walletMagic), content[:len(walletMagic)])
+
+	loaded, err := decodeWallet(content)
+	assert.NoError(t, err)
+	assert.Equal(t, w.GetAddresses(), loaded.GetAddresses())
+	assert.Equal(t, w.Accounts[address].PublicKey, loaded.Accounts[address].PublicKey)
+	assert.Equal(t, "main", loaded.GetInfo(address).Label)
+
+	content[len(walletMagic)] = 9
+	_, err = decodeWallet(content)
+	assert.Error(t, err, "unknown versions are rejected")
+}
+
+// legacyCurve stands in for the curve gob encoded by old wallets.
+type legacyCurve struct{ Name string }
+
+func Test_WalletLegacyMigration(t *testing.T) {
+	type publicKey struct {
+		Curve interface{}
+		X, Y  *big.Int
+	}
+	type privateKey struct {
+		PublicKey publicKey
+		D         *big.Int
+	}
+	type account struct {
+		PrivateKey privateKey
+		PublicKey  []byte
+	}
+
+	a := NewAccount()
+	old := struct{ Accounts map[string]*account }{map[string]*account{
+		a.String(): {
+			PrivateKey: privateKey{
+				PublicKey: publicKey{Curve: legacyCurve{"P-256"}, X: a.PrivateKey.X, Y: a.PrivateKey.Y},
+				D:         a.PrivateKey.D,
+			},
+			PublicKey: a.PublicKey,
+		},
+	}}
+
+	gob.Register(legacyCurve{})
+	var buf bytes.Buffer
+	assert.NoError(t, gob.NewEncoder(&buf).Encode(old))
+
+	w, err := decodeWallet(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{a.String()}, w.GetAddresses())
+	assert.Equal(t, a.PublicKey, w.Accounts[a.String()].PublicKey)
+
+	// old wallets dropped the leading zero bytes of the coordinates.
+	short := NewAccount()
+	for len(legacyPubKeyBytes(&short.PrivateKey.PublicKey)) == 64 {
+		short = NewAccount()
+	}
+	short.PublicKey = legacyPubKeyBytes(&short.PrivateKey.PublicKey)
+	old.Accounts = map[string]*account{short.String(): {
+		PrivateKey: privateKey{
+			PublicKey: publicKey{Curve: legacyCurve{"P-256"}, X: short.PrivateKey.X, Y: short.PrivateKey.Y},
+			D:         short.PrivateKey.D,
+		},
+		PublicKey: short.PublicKey,
+	}}
+	buf.Reset()
+	assert.NoError(t, gob.NewEncoder(&buf).Encode(old))
+
+	w, err = decodeWallet(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{short.String()}, w.GetAddresses(), "the address that received the coins")
+	content, err := encodeWallet(w)
+	assert.NoError(t, err)
+	w, err = decodeWallet(content)
+	assert.NoError(t, err)
+	assert.Equal(t, short.PublicKey, w.Accounts[short.String()].PublicKey)
+
+	// the coins of the address can be spent.
+	prev := Transaction{ID: []byte{1}, Vout: []TxOutput{*NewTxOutput(5, short.String())}}
+	tx := &Transaction{Vin: []TxInput{{TxId: prev.ID}}, Vout: []TxOutput{*NewTxOutput(5, a.String())}}
+	prevTxs := map[string]Transaction{hex.EncodeToString(prev.ID): prev}
+	assert.NoError(t, tx.Sign(w.Accounts[short.String()].PrivateKey, prevTxs))
+	ok, err := tx.Verify(prevTxs)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func Test_PruneWalletBackups(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { _ = os.Chdir(wd) }()
+	assert.NoError(t, os.MkdirAll(walletBackupDir, 0700))
+
+	mainPrefix := MainNetParams.dataFile(walletBackupFilename, "3000")
+	testPrefix := TestNetParams.dataFile(walletBackupFilename, "3000")
+	stamp := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < walletBackupsKept+2; i++ {
+		for _, prefix := range []string{mainPrefix, testPrefix} {
+			name := prefix + stamp.Add(time.Duration(i)*time.Second).Format(walletBackupLayout) + ".dat"
+			assert.NoError(t, os.WriteFile(filepath.Join(walletBackupDir, name), nil, 0600))
+		}
+	}
+
+	assert.NoError(t, pruneWalletBackups(mainPrefix))
+	entries, err := os.ReadDir(walletBackupDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, walletBackupsKept+walletBackupsKept+2, "the test network backups are kept")
+	assert.NoError(t, pruneWalletBackups(testPrefix))
+	entries, err = os.ReadDir(walletBackupDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2*walletBackupsKept)
+}
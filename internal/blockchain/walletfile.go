@@ -0,0 +1,297 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// walletMagic starts every versioned wallet file, older wallets are a bare
+	// gob encoded Wallet.
+	walletMagic = "BCGW"
+	// walletVersion is the version of the wallet files written by Save.
+	walletVersion uint32 = 1
+
+	walletBackupDir      = "zblock/wallets/backups"
+	walletBackupFilename = "wallet_%s_"
+	walletBackupsKept    = 10
+	// walletBackupLayout is the timestamp following the backup prefix.
+	walletBackupLayout = "20060102T150405.000000000"
+)
+
+// walletFileV1 is the content of a version 1 wallet file. Accounts only keep
+// their private key scalar, the public key is derived from it when loading.
+type walletFileV1 struct {
+	Accounts  [][]byte
+	Scripts   map[string][]byte
+	WatchOnly map[string]*WatchOnly
+	Info      map[string]*AddressInfo
+	// LegacyPubKeys are the public keys of accounts migrated from old wallets
+	// whose encoding is shorter than the derived one, by derived address.
+	LegacyPubKeys map[string][]byte
+}
+
+// legacyWallet decodes the unversioned gob wallets, the curve of the keys is
+// skipped as it can't be decoded by every Go version.
+type legacyWallet struct {
+	Accounts map[string]*struct {
+		PrivateKey struct {
+			D *big.Int
+		}
+		PublicKey []byte
+	}
+	Scripts   map[string][]byte
+	WatchOnly map[string]*WatchOnly
+	Info      map[string]*AddressInfo
+}
+
+// encodeWallet serializes w in the current wallet file format.
+func encodeWallet(w *Wallet) ([]byte, error) {
+	file := walletFileV1{Scripts: w.Scripts, WatchOnly: w.WatchOnly, Info: w.Info}
+	for _, account := range w.Accounts {
+		file.Accounts = append(file.Accounts, account.PrivateKey.D.FillBytes(make([]byte, privateKeyLen)))
+
+		derived := pubKeyBytes(&account.PrivateKey.PublicKey)
+		if !bytes.Equal(account.PublicKey, derived) {
+			if file.LegacyPubKeys == nil {
+				file.LegacyPubKeys = make(map[string][]byte)
+			}
+			address := string(encodeAddress(activeParams.PubKeyHashAddrID, HashPubKey(derived)))
+			file.LegacyPubKeys[address] = account.PublicKey
+		}
+	}
+	sort.Slice(file.Accounts, func(i, j int) bool {
+		return bytes.Compare(file.Accounts[i], file.Accounts[j]) < 0
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(walletMagic)
+	_ = binary.Write(&buf, binary.LittleEndian, walletVersion)
+	if err := gob.NewEncoder(&buf).Encode(file); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeWallet parses a wallet file of any version.
+func decodeWallet(content []byte) (*Wallet, error) {
+	w := &Wallet{
+		Accounts:  make(map[string]*Account),
+		Scripts:   make(map[string][]byte),
+		WatchOnly: make(map[string]*WatchOnly),
+		Info:      make(map[string]*AddressInfo),
+	}
+
+	if !bytes.HasPrefix(content, []byte(walletMagic)) {
+		return w, decodeLegacyWallet(w, content)
+	}
+
+	content = content[len(walletMagic):]
+	if len(content) < 4 {
+		return nil, fmt.Errorf("wallet file is truncated")
+	}
+	version := binary.LittleEndian.Uint32(content)
+	if version != walletVersion {
+		return nil, fmt.Errorf("wallet file version %d is not supported, want %d", version, walletVersion)
+	}
+
+	var file walletFileV1
+	if err := gob.NewDecoder(bytes.NewReader(content[4:])).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	for _, key := range file.Accounts {
+		account, err := accountFromKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if pubKey, ok := file.LegacyPubKeys[account.String()]; ok {
+			account.PublicKey = pubKey
+		}
+		w.Accounts[account.String()] = account
+	}
+	w.setMaps(file.Scripts, file.WatchOnly, file.Info)
+
+	return w, nil
+}
+
+// decodeLegacyWallet fills w from an unversioned gob wallet.
+func decodeLegacyWallet(w *Wallet, content []byte) error {
+	var legacy legacyWallet
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&legacy); err != nil {
+		return fmt.Errorf("wallet file is not valid: %w", err)
+	}
+
+	for _, entry := range legacy.Accounts {
+		if entry == nil || entry.PrivateKey.D == nil {
+			continue
+		}
+		account, err := accountFromKey(entry.PrivateKey.D.Bytes())
+		if err != nil {
+			return err
+		}
+		// the coins are locked to the address of the stored public key.
+		if len(entry.PublicKey) > 0 {
+			if !bytes.Equal(legacyPubKeyBytes(&account.PrivateKey.PublicKey), entry.PublicKey) &&
+				!bytes.Equal(account.PublicKey, entry.PublicKey) {
+				return fmt.Errorf("wallet file is not valid: public key does not match its private key")
+			}
+			account.PublicKey = entry.PublicKey
+		}
+		w.Accounts[account.String()] = account
+	}
+	w.setMaps(legacy.Scripts, legacy.WatchOnly, legacy.Info)
+
+	return nil
+}
+
+// setMaps replaces the wallet maps with the decoded ones that are set.
+func (w *Wallet) setMaps(scripts map[string][]byte, watchOnly map[string]*WatchOnly, info map[string]*AddressInfo) {
+	if scripts != nil {
+		w.Scripts = scripts
+	}
+	if watchOnly != nil {
+		w.WatchOnly = watchOnly
+	}
+	if info != nil {
+		w.Info = info
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so path holds either the old or the new content after a crash.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+
+	return nil
+}
+
+// backupWalletFile copies the wallet file of node to a timestamped file in
+// the backup directory and keeps only the latest backups. It does nothing when
+// there is no wallet file yet.
+func backupWalletFile(node string) (string, error) {
+	content, err := os.ReadFile(activeParams.dataFile(wallerFilename, node))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(walletBackupDir, 0700); err != nil {
+		return "", err
+	}
+
+	prefix := activeParams.dataFile(walletBackupFilename, node)
+	backup := filepath.Join(walletBackupDir, prefix+time.Now().UTC().Format(walletBackupLayout)+".dat")
+	if err := writeFileAtomic(backup, content); err != nil {
+		return "", err
+	}
+
+	return backup, pruneWalletBackups(prefix)
+}
+
+// pruneWalletBackups removes the oldest backups named prefix, a timestamp and
+// .dat. The main network prefix starts the names of the other networks too.
+func pruneWalletBackups(prefix string) error {
+	entries, err := os.ReadDir(walletBackupDir)
+	if err != nil {
+		return err
+	}
+
+	// timestamps sort in the order of the names.
+	var backups []string
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || !strings.HasSuffix(stamp, ".dat") {
+			continue
+		}
+		if _, err := time.Parse(walletBackupLayout, strings.TrimSuffix(stamp, ".dat")); err == nil {
+			backups = append(backups, entry.Name())
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > walletBackupsKept {
+		if err := os.Remove(filepath.Join(walletBackupDir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// BackupWallet writes a copy of the wallet file of node to dest, or to a
+// timestamped file in the backup directory when dest is empty, and returns
+// the path of the copy.
+func BackupWallet(node, dest string) (string, error) {
+	if dest == "" {
+		backup, err := backupWalletFile(node)
+		if err == nil && backup == "" {
+			err = fmt.Errorf("node %s has no wallet", node)
+		}
+		return backup, err
+	}
+
+	content, err := os.ReadFile(activeParams.dataFile(wallerFilename, node))
+	if err != nil {
+		return "", err
+	}
+
+	return dest, writeFileAtomic(dest, content)
+}
+
+// RestoreWallet replaces the wallet of node with the wallet file src, of any
+// version, after backing up the current one. It returns the restored wallet.
+func RestoreWallet(node, src string) (*Wallet, error) {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := decodeWallet(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, w.Save(node)
+}
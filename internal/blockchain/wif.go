@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/sphierex/blockchain-go/pkg/base58"
+)
+
+// privateKeyLen is the length of a private key scalar in the import format.
+const privateKeyLen = 32
+
+var ErrInvalidWIF = errors.New("private key is not valid")
+
+// WIF returns the private key of the account in Wallet Import Format: the
+// network private key version, the key scalar and a checksum, Base58 encoded.
+func (a *Account) WIF() string {
+	payload := make([]byte, 1+privateKeyLen)
+	payload[0] = activeParams.PrivateKeyID
+	a.PrivateKey.D.FillBytes(payload[1:])
+
+	return string(base58.Encode(append(payload, checksum(payload)...)))
+}
+
+// DecodeWIF returns the account of a private key in Wallet Import Format.
+func DecodeWIF(wif string) (*Account, error) {
+	payload := base58.Decode([]byte(wif))
+	if len(payload) != 1+privateKeyLen+accountChecksumLen {
+		return nil, ErrInvalidWIF
+	}
+
+	versionPayload := payload[:len(payload)-accountChecksumLen]
+	if !bytes.Equal(payload[len(payload)-accountChecksumLen:], checksum(versionPayload)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidWIF)
+	}
+	if versionPayload[0] != activeParams.PrivateKeyID {
+		for _, params := range registeredParams {
+			if versionPayload[0] == params.PrivateKeyID {
+				return nil, fmt.Errorf("%w: key belongs to the %s network", ErrInvalidWIF, params.Name)
+			}
+		}
+		return nil, fmt.Errorf("%w: unknown version 0x%02x", ErrInvalidWIF, versionPayload[0])
+	}
+
+	account, err := accountFromKey(versionPayload[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWIF, err)
+	}
+
+	return account, nil
+}
+
+// accountFromKey returns the account of a private key scalar.
+func accountFromKey(key []byte) (*Account, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(key)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key scalar out of range")
+	}
+
+	private := ecdsa.PrivateKey{D: d}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, privateKeyLen)))
+
+	return &Account{PrivateKey: private, PublicKey: pubKeyBytes(&private.PublicKey)}, nil
+}
@@ -29,7 +29,7 @@ func Encode(v []byte) []byte {
 	}
 	fn(result)
 
-	for b := range v {
+	for _, b := range v {
 		if b == 0x00 {
 			result = append([]byte{b58Alphabet[0]}, result...)
 		} else {
@@ -40,20 +40,25 @@ func Encode(v []byte) []byte {
 	return result
 }
 
-// Decode decodes Base58-encoded data
+// Decode decodes Base58-encoded data, it returns nil if v contains a character
+// outside the alphabet.
 func Decode(v []byte) []byte {
 	result := big.NewInt(0)
 	zeroBytes := 0
 
-	for b := range v {
-		if b == 0x00 {
-			zeroBytes++
+	for _, b := range v {
+		if b != b58Alphabet[0] {
+			break
 		}
+		zeroBytes++
 	}
 
 	payload := v[zeroBytes:]
 	for _, b := range payload {
 		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil
+		}
 		result.Mul(result, big.NewInt(58))
 		result.Add(result, big.NewInt(int64(charIndex)))
 	}
@@ -0,0 +1,29 @@
+package base58
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EncodeDecode(t *testing.T) {
+	cases := []struct {
+		raw     []byte
+		encoded string
+	}{
+		{[]byte{}, ""},
+		{[]byte{0x00}, "1"},
+		{[]byte{0x00, 0x00, 0x01}, "112"},
+		{[]byte("hello world"), "StV1DL6CwTryKyV"},
+		{[]byte{0x05, 0xff}, "TU"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.encoded, string(Encode(c.raw)))
+		assert.Equal(t, c.raw, Decode([]byte(c.encoded)))
+	}
+}
+
+func Test_DecodeInvalid(t *testing.T) {
+	assert.Nil(t, Decode([]byte("0OIl")))
+}
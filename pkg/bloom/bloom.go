@@ -0,0 +1,127 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+const (
+	// MaxFilterSize is the largest filter in bytes a peer may load.
+	MaxFilterSize = 36000
+	// MaxHashFuncs is the most hash functions a filter may use.
+	MaxHashFuncs = 50
+
+	ln2Squared = math.Ln2 * math.Ln2
+	// hashSeedStep spreads the seeds of the hash functions.
+	hashSeedStep = 0xfba4c795
+)
+
+// Filter is a BIP37 style bloom filter. It may tell that data was added when
+// it wasn't, but never that data added to it is missing.
+type Filter struct {
+	Bits      []byte
+	HashFuncs uint32
+	Tweak     uint32
+}
+
+// New returns a filter sized for elements items with a false positive rate of
+// about fpRate, tweak changes the hash functions.
+func New(elements int, fpRate float64, tweak uint32) *Filter {
+	if elements < 1 {
+		elements = 1
+	}
+	fpRate = math.Max(1e-9, math.Min(fpRate, 1))
+
+	size := int(-1 / ln2Squared * float64(elements) * math.Log(fpRate) / 8)
+	size = min(max(size, 1), MaxFilterSize)
+
+	hashFuncs := int(float64(size*8) / float64(elements) * math.Ln2)
+	hashFuncs = min(max(hashFuncs, 1), MaxHashFuncs)
+
+	return &Filter{
+		Bits:      make([]byte, size),
+		HashFuncs: uint32(hashFuncs),
+		Tweak:     tweak,
+	}
+}
+
+// IsValid checks the filter a peer sent is within the size limits.
+func (f *Filter) IsValid() bool {
+	return len(f.Bits) > 0 && len(f.Bits) <= MaxFilterSize && f.HashFuncs > 0 && f.HashFuncs <= MaxHashFuncs
+}
+
+func (f *Filter) bit(i uint32, data []byte) uint32 {
+	return MurmurHash3(i*hashSeedStep+f.Tweak, data) % uint32(len(f.Bits)*8)
+}
+
+// Add adds data to the filter.
+func (f *Filter) Add(data []byte) {
+	for i := uint32(0); i < f.HashFuncs; i++ {
+		bit := f.bit(i, data)
+		f.Bits[bit>>3] |= 1 << (bit & 7)
+	}
+}
+
+// Contains checks whether data may have been added to the filter.
+func (f *Filter) Contains(data []byte) bool {
+	if len(f.Bits) == 0 {
+		return false
+	}
+
+	for i := uint32(0); i < f.HashFuncs; i++ {
+		bit := f.bit(i, data)
+		if f.Bits[bit>>3]&(1<<(bit&7)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MurmurHash3 returns the 32 bits x86 MurmurHash3 of data.
+func MurmurHash3(seed uint32, data []byte) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
@@ -0,0 +1,58 @@
+package bloom
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MurmurHash3(t *testing.T) {
+	tests := []struct {
+		seed uint32
+		data string
+		hash uint32
+	}{
+		{0x00000000, "", 0x00000000},
+		{0xfba4c795, "", 0x6a396f08},
+		{0xffffffff, "", 0x81f16f39},
+		{0x00000000, "00", 0x514e28b7},
+		{0xfba4c795, "00", 0xea3f0b17},
+		{0x00000000, "ff", 0xfd6cf10d},
+		{0x00000000, "0011", 0x16c6b7ab},
+		{0x00000000, "001122", 0x8eb51c3d},
+		{0x00000000, "00112233", 0xb4471bf8},
+		{0x00000000, "0011223344", 0xe2301fa8},
+		{0x00000000, "00112233445566", 0xb074502c},
+		{0x00000000, "0011223344556677", 0x8034d2a0},
+	}
+
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.data)
+		assert.Equal(t, test.hash, MurmurHash3(test.seed, data), "seed %x data %s", test.seed, test.data)
+	}
+}
+
+func Test_Filter(t *testing.T) {
+	f := New(100, 0.01, 0)
+	assert.True(t, f.IsValid())
+
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(fmt.Sprintf("element %d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		assert.True(t, f.Contains([]byte(fmt.Sprintf("element %d", i))), "no false negative")
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.Contains([]byte(fmt.Sprintf("other %d", i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300, "false positive rate stays near the target")
+
+	assert.False(t, (&Filter{}).Contains([]byte("element 0")))
+	assert.False(t, (&Filter{Bits: make([]byte, MaxFilterSize+1), HashFuncs: 1}).IsValid())
+}
@@ -1,9 +1,30 @@
 package merkle
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrIndexOutOfRange = errors.New("leaf index is out of range")
 
 type MerkleTree struct {
 	RootNode *MerkleNode
+	// Mutated is set when two paired nodes are equal. Duplicating the last
+	// leaves of a list, like [a b c] into [a b c c], keeps the root, so a tree
+	// with equal siblings must not be trusted to commit to its data.
+	Mutated bool
+
+	// levels holds the hashes of every level, leaves first.
+	levels [][][]byte
+}
+
+// ProofStep is a sibling hash on the path from a leaf to the root. Left tells
+// whether the sibling is hashed on the left of the path, as the leaf index
+// implies.
+type ProofStep struct {
+	Hash []byte
+	Left bool
 }
 
 type MerkleNode struct {
@@ -30,30 +51,121 @@ func NewNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	return &node
 }
 
+// New builds the tree of data. A level with an odd number of nodes pairs its
+// last node with itself, and the leaves are always hashed once so a single
+// leaf is paired with itself too. The tree of no data has a zero root.
 func New(data [][]byte) *MerkleTree {
-	var nodes []MerkleNode
-
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	mTree := MerkleTree{}
+	if len(data) == 0 {
+		mTree.RootNode = &MerkleNode{Data: make([]byte, sha256.Size)}
+		return &mTree
 	}
 
+	var nodes []*MerkleNode
 	for _, v := range data {
-		node := NewNode(nil, nil, v)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, NewNode(nil, nil, v))
 	}
+	mTree.addLevel(nodes)
 
-	for i := 0; i < len(data)/2; i++ {
-		var newNodes []MerkleNode
+	for len(mTree.levels) == 1 || len(nodes) > 1 {
+		var newNodes []*MerkleNode
 
 		for j := 0; j < len(nodes); j += 2 {
-			node := NewNode(&nodes[j], &nodes[j+1], nil)
-			newNodes = append(newNodes, *node)
+			left, right := nodes[j], nodes[j]
+			if j+1 < len(nodes) {
+				right = nodes[j+1]
+				// equal siblings make the root collide with the one of a
+				// shorter list, see Mutated.
+				if bytes.Equal(left.Data, right.Data) {
+					mTree.Mutated = true
+				}
+			}
+			newNodes = append(newNodes, NewNode(left, right, nil))
 		}
 
 		nodes = newNodes
+		mTree.addLevel(nodes)
 	}
 
-	mTree := MerkleTree{&nodes[0]}
+	mTree.RootNode = nodes[0]
 
 	return &mTree
 }
+
+func (t *MerkleTree) addLevel(nodes []*MerkleNode) {
+	level := make([][]byte, 0, len(nodes))
+	for _, node := range nodes {
+		level = append(level, node.Data)
+	}
+
+	t.levels = append(t.levels, level)
+}
+
+// Proof returns the sibling hashes on the path from the leaf at index to the
+// root, lowest level first.
+func (t *MerkleTree) Proof(index int) ([]ProofStep, error) {
+	if len(t.levels) == 0 || index < 0 || index >= len(t.levels[0]) {
+		return nil, ErrIndexOutOfRange
+	}
+
+	var proof []ProofStep
+	for _, level := range t.levels[:len(t.levels)-1] {
+		// the last node of an odd level is paired with itself.
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+
+		proof = append(proof, ProofStep{Hash: level[sibling], Left: sibling < index})
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// Depth returns the number of steps in the proof of a leaf of a tree of count
+// leaves. A single leaf is paired with itself, so its proof has one step.
+func Depth(count int) int {
+	depth := 1
+	for width := 2; width < count; width *= 2 {
+		depth++
+	}
+
+	return depth
+}
+
+// VerifyProof checks that leaf is the leaf at index of a tree of count leaves
+// with root, given the proof returned by Proof for it. The side each sibling
+// is hashed on comes from index, the Left of the steps isn't trusted, and the
+// proof must be exactly as long as the tree is deep.
+func VerifyProof(root, leaf []byte, index, count int, proof []ProofStep) bool {
+	if index < 0 || index >= count || len(proof) != Depth(count) {
+		return false
+	}
+
+	hash := sha256.Sum256(leaf)
+	current := hash[:]
+
+	for width, i := count, 0; i < len(proof); width, i = (width+1)/2, i+1 {
+		step := proof[i]
+
+		var data []byte
+		switch {
+		case index%2 == 1:
+			data = append(append(data, step.Hash...), current...)
+		case index == width-1:
+			// the last node of an odd level is paired with itself.
+			if !bytes.Equal(step.Hash, current) {
+				return false
+			}
+			data = append(append(data, current...), current...)
+		default:
+			data = append(append(data, current...), step.Hash...)
+		}
+		hash = sha256.Sum256(data)
+		current = hash[:]
+		index /= 2
+	}
+
+	return bytes.Equal(current, root)
+}
@@ -1,8 +1,10 @@
 package merkle
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -71,3 +73,127 @@ func Test_MerkleTree(t *testing.T) {
 
 	assert.Equal(t, rootHash, fmt.Sprintf("%x", mTree.RootNode.Data), "Merkle tree root hash is correct")
 }
+
+func Test_MerkleProof(t *testing.T) {
+	data := [][]byte{
+		[]byte("node1"),
+		[]byte("node2"),
+		[]byte("node3"),
+		[]byte("node4"),
+	}
+	mTree := New(data)
+	root := mTree.RootNode.Data
+
+	for i, leaf := range data {
+		proof, err := mTree.Proof(i)
+		assert.Nil(t, err)
+		assert.Len(t, proof, 2)
+		assert.True(t, VerifyProof(root, leaf, i, len(data), proof), "proof of leaf %d is valid", i)
+		assert.False(t, VerifyProof(root, []byte("node5"), i, len(data), proof), "proof doesn't hold for another leaf")
+	}
+
+	proof, _ := mTree.Proof(0)
+	assert.False(t, VerifyProof(root, data[1], 0, len(data), proof), "proof is bound to the leaf")
+	assert.False(t, VerifyProof(root, data[0], 1, len(data), proof), "proof is bound to the leaf position")
+	assert.False(t, VerifyProof(root, data[0], 0, 8, proof), "proof is as deep as the tree")
+
+	// the sides come from the index, not from the steps.
+	flipped := append([]ProofStep{}, proof...)
+	flipped[0].Left = !flipped[0].Left
+	assert.True(t, VerifyProof(root, data[0], 0, len(data), flipped))
+
+	odd := New(data[:3])
+	proof, _ = odd.Proof(2)
+	proof[0].Hash = odd.levels[0][1]
+	assert.False(t, VerifyProof(odd.RootNode.Data, data[2], 2, 3, proof), "the last node of an odd level is paired with itself")
+
+	// a proof of the tree's leaf count can't stop at an inner node and pass
+	// it as a leaf.
+	inner := append(append([]byte{}, mTree.levels[0][0]...), mTree.levels[0][1]...)
+	assert.False(t, VerifyProof(root, inner, 0, len(data), proof[1:]))
+
+	_, err := mTree.Proof(len(data))
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+}
+
+// referenceRoot computes the root level by level the slow way.
+func referenceRoot(data [][]byte) []byte {
+	if len(data) == 0 {
+		return make([]byte, sha256.Size)
+	}
+
+	var level [][]byte
+	for _, v := range data {
+		hash := sha256.Sum256(v)
+		level = append(level, hash[:])
+	}
+
+	for first := true; first || len(level) > 1; first = false {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			hash := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, hash[:])
+		}
+		level = next
+	}
+
+	return level[0]
+}
+
+func randomLeaves(r *rand.Rand, n int) [][]byte {
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = make([]byte, 1+r.Intn(64))
+		r.Read(data[i])
+	}
+
+	return data
+}
+
+func Test_MerkleTreeProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	assert.Equal(t, make([]byte, sha256.Size), New(nil).RootNode.Data, "empty tree has a zero root")
+
+	for n := 0; n <= 70; n++ {
+		data := randomLeaves(r, n)
+		mTree := New(data)
+		root := mTree.RootNode.Data
+
+		assert.Equal(t, referenceRoot(data), root, "root of %d leaves", n)
+		assert.False(t, mTree.Mutated, "%d distinct leaves are not mutated", n)
+
+		for i, leaf := range data {
+			proof, err := mTree.Proof(i)
+			assert.Nil(t, err)
+			assert.True(t, VerifyProof(root, leaf, i, n, proof), "proof of leaf %d of %d", i, n)
+			assert.Len(t, proof, Depth(n))
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		// any changed leaf changes the root.
+		changed := append([][]byte{}, data...)
+		changed[r.Intn(n)] = []byte("changed")
+		assert.NotEqual(t, root, New(changed).RootNode.Data, "changed leaf of %d leaves", n)
+
+		// duplicating the odd last leaf keeps the root but is detected.
+		if n > 1 && n%2 != 0 {
+			mutated := New(append(append([][]byte{}, data...), data[n-1]))
+			assert.Equal(t, root, mutated.RootNode.Data, "duplicated leaf of %d leaves", n)
+			assert.True(t, mutated.Mutated, "duplicated leaf of %d leaves is detected", n)
+		}
+		// so does duplicating an odd pair of the level above.
+		if n > 2 && n%4 == 2 {
+			mutated := New(append(append([][]byte{}, data...), data[n-2:]...))
+			assert.Equal(t, root, mutated.RootNode.Data, "duplicated pair of %d leaves", n)
+			assert.True(t, mutated.Mutated, "duplicated pair of %d leaves is detected", n)
+		}
+	}
+}